@@ -0,0 +1,87 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	addonsCount = newSummedDesc(
+		prometheus.BuildFQName(namespace, "", "addons"),
+		"How many add-ons are installed.",
+		labelNames("type", "enabled"), "type",
+	)
+	addonsBroken = newSummedDesc(
+		prometheus.BuildFQName(namespace, "", "addons_broken"),
+		"How many installed add-ons are marked as broken.",
+		labelNames("type"), "type",
+	)
+	addonInfo = newLimitedDesc(
+		prometheus.BuildFQName(namespace, "", "addon_info"),
+		"Information about an installed add-on.",
+		labelNames("addonid", "version", "enabled"),
+	)
+)
+
+func (e *Exporter) collectAddonsMetrics(ch chan<- prometheus.Metric) error {
+	resp, err := e.client.AddonsGetAddons()
+	if err != nil || resp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+		return rpcError(err, resp.Error)
+	}
+
+	type addonKey struct {
+		addonType string
+		enabled   string
+	}
+	counts := map[addonKey]int{}
+	broken := map[string]int{}
+	for _, addon := range resp.Result.Addons {
+		enabled := strconv.FormatBool(addon.Enabled)
+		counts[addonKey{addon.Type, enabled}]++
+		if addon.IsBroken() {
+			broken[addon.Type]++
+		} else if _, ok := broken[addon.Type]; !ok {
+			broken[addon.Type] = 0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			addonInfo, prometheus.GaugeValue, 1,
+			addon.AddonID, addon.Version, enabled,
+		)
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			addonsCount, prometheus.GaugeValue, float64(count),
+			key.addonType, key.enabled,
+		)
+	}
+	for addonType, count := range broken {
+		ch <- prometheus.MustNewConstMetric(
+			addonsBroken, prometheus.GaugeValue, float64(count),
+			addonType,
+		)
+	}
+	e.logger.Infof("Addons: %d", len(resp.Result.Addons))
+	return nil
+}
+
+func init() {
+	registerCollector("addons", false, func(e *Exporter) Collector {
+		return collectorFunc(e.collectAddonsMetrics)
+	}, "Export the inventory of the installed add-ons.")
+}
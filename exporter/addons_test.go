@@ -0,0 +1,62 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func TestAddonsMetrics(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"Addons.GetAddons": `{"id":1,"jsonrpc":"2.0","result":{"addons":[` +
+			`{"addonid":"plugin.video.youtube","broken":false,"enabled":true,"installed":true,"name":"YouTube","type":"xbmc.python.pluginsource","version":"5.3.6"},` +
+			`{"addonid":"plugin.video.arte","broken":"","enabled":true,"installed":true,"name":"Arte","type":"xbmc.python.pluginsource","version":"1.0.1"},` +
+			`{"addonid":"script.old","broken":"Not compatible","enabled":false,"installed":true,"name":"Old","type":"xbmc.python.script","version":"1.0.0"}` +
+			`],"limits":{"end":3,"start":0,"total":3}}}`,
+	})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectAddonsMetrics(ch)
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for desc, expected := range map[*prometheus.Desc]map[string]float64{
+		addonsCount: {
+			"enabled=true,type=xbmc.python.pluginsource": 2,
+			"enabled=false,type=xbmc.python.script":      1,
+		},
+		addonsBroken: {
+			"type=xbmc.python.pluginsource": 0,
+			"type=xbmc.python.script":       1,
+		},
+		addonInfo: {
+			"addonid=plugin.video.youtube,enabled=true,version=5.3.6": 1,
+			"addonid=plugin.video.arte,enabled=true,version=1.0.1":    1,
+			"addonid=script.old,enabled=false,version=1.0.0":          1,
+		},
+	} {
+		if values := metricValues(t, metrics, desc); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Invalid values of %s: %v", desc, values)
+		}
+	}
+}
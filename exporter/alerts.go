@@ -0,0 +1,304 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	// AlertsPath is the path of the webhook receiver
+	AlertsPath = "/api/v1/alerts"
+
+	// defaultAlertTarget is the Kodi server of the exporter
+	defaultAlertTarget = "default"
+
+	// minAlertDisplayTime is the minimum display time of the notifications
+	// accepted by Kodi
+	minAlertDisplayTime = 1500 * time.Millisecond
+
+	// alertRetryWindow is how long the alerts shown on a target are
+	// remembered, so the retries of Alertmanager don't show them again
+	alertRetryWindow = 5 * time.Minute
+
+	defaultAlertTitle   = `{{ if eq .Status "resolved" }}[RESOLVED] {{ end }}{{ .Labels.alertname }}`
+	defaultAlertMessage = `{{ if .Annotations.summary }}{{ .Annotations.summary }}{{ else }}{{ .Annotations.description }}{{ end }}`
+)
+
+// alertsLabels are the labels of the notifications counter
+var alertsLabels = labelNames("target", "result")
+
+// defaultAlertIcons are the images of the notifications, by severity
+var defaultAlertIcons = map[string]string{
+	"critical": "error",
+	"error":    "error",
+	"warning":  "warning",
+	"info":     "info",
+	"resolved": "info",
+}
+
+// webhookMessage is the payload sent by the Alertmanager webhooks
+type webhookMessage struct {
+	Version           string            `json:"version"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []alert           `json:"alerts"`
+}
+
+// alert is an alert sent by Alertmanager, used as the data of the templates
+type alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+}
+
+// AlertsOptions are the options of an AlertsReceiver
+type AlertsOptions struct {
+	// Client queries the Kodi server of the exporter. It is required.
+	Client *kodi.Client
+	// Config is the alerts configuration
+	Config AlertsConfig
+	// Logger defaults to the base logger
+	Logger log.Logger
+}
+
+// AlertsReceiver is an Alertmanager webhook receiver, which shows the alerts
+// as notifications on the Kodi servers.
+// It implements http.Handler and prometheus.Collector.
+type AlertsReceiver struct {
+	title         *template.Template
+	message       *template.Template
+	displayTime   int
+	icons         map[string]string
+	targets       map[string]*kodi.Client
+	routes        []AlertRouteConfig
+	notifications *prometheus.CounterVec
+	mu            sync.Mutex
+	delivered     map[string]time.Time
+	logger        log.Logger
+}
+
+// NewAlertsReceiver returns a webhook receiver for the alerts. The alerts
+// which don't match a route are shown on the Kodi server of the exporter.
+func NewAlertsReceiver(opts AlertsOptions) (*AlertsReceiver, error) {
+	if opts.Client == nil {
+		return nil, fmt.Errorf("Kodi client not configured")
+	}
+	config := opts.Config
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if len(config.Title) == 0 {
+		config.Title = defaultAlertTitle
+	}
+	if len(config.Message) == 0 {
+		config.Message = defaultAlertMessage
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Base()
+	}
+	r := &AlertsReceiver{
+		logger:      logger,
+		title:       template.Must(template.New("title").Option("missingkey=zero").Parse(config.Title)),
+		message:     template.Must(template.New("message").Option("missingkey=zero").Parse(config.Message)),
+		displayTime: int(config.DisplayTime / time.Millisecond),
+		icons:       map[string]string{},
+		targets:     map[string]*kodi.Client{defaultAlertTarget: opts.Client},
+		routes:      config.Routes,
+		delivered:   map[string]time.Time{},
+		notifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "alerts",
+			Name:      "notifications_total",
+			Help:      "How many alerts were shown as Kodi notifications.",
+		}, alertsLabels),
+	}
+	for severity, icon := range defaultAlertIcons {
+		r.icons[severity] = icon
+	}
+	for severity, icon := range config.Icons {
+		r.icons[severity] = icon
+	}
+	for name, target := range config.Targets {
+		targetClient, err := kodi.NewClient(target.URI, target.Username, target.Password)
+		if err != nil {
+			return nil, fmt.Errorf("Alerts: can't create the Kodi client of %s: %s", name, err)
+		}
+		r.targets[name] = targetClient
+	}
+	return r, nil
+}
+
+// route returns the targets of an alert, from the first matching route
+func (r *AlertsReceiver) route(labels map[string]string) []string {
+	for _, route := range r.routes {
+		matched := true
+		for name, value := range route.Match {
+			if labels[name] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route.Targets
+		}
+	}
+	return []string{defaultAlertTarget}
+}
+
+func (r *AlertsReceiver) icon(a *alert) string {
+	if a.Status == "resolved" {
+		return r.icons["resolved"]
+	}
+	if icon, ok := r.icons[a.Labels["severity"]]; ok {
+		return icon
+	}
+	return r.icons["info"]
+}
+
+func (r *AlertsReceiver) render(a *alert) (string, string, error) {
+	var title, message bytes.Buffer
+	if err := r.title.Execute(&title, a); err != nil {
+		return "", "", err
+	}
+	if err := r.message.Execute(&message, a); err != nil {
+		return "", "", err
+	}
+	return title.String(), message.String(), nil
+}
+
+// alertKey identifies the notification of an alert on a target
+func alertKey(target string, a *alert) string {
+	names := []string{}
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	key := []string{target, a.Status, a.StartsAt.UTC().Format(time.RFC3339Nano)}
+	for _, name := range names {
+		key = append(key, name+"="+a.Labels[name])
+	}
+	return strings.Join(key, "\xff")
+}
+
+// shown returns true if a notification was shown during the retry window
+func (r *AlertsReceiver) shown(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivered, ok := r.delivered[key]
+	return ok && now.Sub(delivered) < alertRetryWindow
+}
+
+// markShown remembers a notification shown, and forgets the notifications
+// older than the retry window
+func (r *AlertsReceiver) markShown(key string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, delivered := range r.delivered {
+		if now.Sub(delivered) >= alertRetryWindow {
+			delete(r.delivered, k)
+		}
+	}
+	r.delivered[key] = now
+}
+
+// notify shows an alert on its targets. It fails if the alert wasn't shown
+// on a target. The targets where the alert was already shown are skipped, so
+// the alerts retried by Alertmanager are only shown where they failed.
+func (r *AlertsReceiver) notify(a *alert, now time.Time) error {
+	title, message, err := r.render(a)
+	if err != nil {
+		return fmt.Errorf("can't render alert %s: %s", a.Labels["alertname"], err)
+	}
+	var lastErr error
+	for _, target := range r.route(a.Labels) {
+		key := alertKey(target, a)
+		if r.shown(key, now) {
+			r.logger.Debugf("Alert %s already shown on %s: %s", a.Status, target, title)
+			continue
+		}
+		r.logger.Infof("Alert %s on %s: %s %s", a.Status, target, title, message)
+		resp, err := r.targets[target].ShowNotificationWithImage(title, message, r.icon(a), r.displayTime)
+		if err == nil && resp.Error != nil {
+			err = fmt.Errorf("%s [%d]", resp.Error.Message, resp.Error.Code)
+		}
+		if err != nil {
+			r.logger.Errorf("Can't show alert on %s: %s", target, err)
+			r.notifications.WithLabelValues(target, "error").Inc()
+			lastErr = fmt.Errorf("can't show alert on %s: %s", target, err)
+			continue
+		}
+		r.notifications.WithLabelValues(target, "success").Inc()
+		r.markShown(key, now)
+	}
+	return lastErr
+}
+
+func (r *AlertsReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	msg := &webhookMessage{}
+	if err := json.NewDecoder(req.Body).Decode(msg); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid webhook message: %s", err))
+		return
+	}
+	var lastErr error
+	now := time.Now()
+	for i := range msg.Alerts {
+		if err := r.notify(&msg.Alerts[i], now); err != nil {
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		// Alertmanager retries the notifications on errors: the alerts
+		// already shown are skipped
+		writeJSONError(w, http.StatusInternalServerError, lastErr.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// Describe implements prometheus.Collector.
+func (r *AlertsReceiver) Describe(ch chan<- *prometheus.Desc) {
+	r.notifications.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *AlertsReceiver) Collect(ch chan<- prometheus.Metric) {
+	r.notifications.Collect(ch)
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const alertsWebhookMessage = `{
+  "version": "4",
+  "status": "firing",
+  "receiver": "kodi",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "BackupFailed", "severity": "critical"},
+      "annotations": {"summary": "Backup of the NAS failed"}
+    },
+    {
+      "status": "resolved",
+      "labels": {"alertname": "Doorbell", "room": "living"},
+      "annotations": {"description": "Someone rang"}
+    }
+  ]
+}`
+
+func TestAlertsReceiver(t *testing.T) {
+	living := &kodiRecorder{}
+	livingServer := httptest.NewServer(living)
+	defer livingServer.Close()
+	bedroom := &kodiRecorder{}
+	bedroomServer := httptest.NewServer(bedroom)
+	defer bedroomServer.Close()
+	client, err := kodi.NewClient(bedroomServer.URL, "", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	r, err := NewAlertsReceiver(AlertsOptions{
+		Client: client,
+		Config: AlertsConfig{
+			DisplayTime: 10 * time.Second,
+			Targets: map[string]AlertTargetConfig{
+				"living-room": {URI: livingServer.URL},
+			},
+			Routes: []AlertRouteConfig{
+				{Match: map[string]string{"room": "living"}, Targets: []string{"living-room"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	a := &alert{Status: "resolved", Labels: map[string]string{"alertname": "Doorbell"}, Annotations: map[string]string{"description": "Someone rang"}}
+	if title, message, _ := r.render(a); title != "[RESOLVED] Doorbell" || message != "Someone rang" {
+		t.Fatalf("Invalid notification: %q %q", title, message)
+	}
+	if icon := r.icon(&alert{Status: "firing", Labels: map[string]string{"severity": "critical"}}); icon != "error" {
+		t.Fatalf("Invalid icon: %s", icon)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", AlertsPath, strings.NewReader(alertsWebhookMessage)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Invalid status: %d %s", w.Code, w.Body.String())
+	}
+	if living.called("GUI.ShowNotification") != 1 || bedroom.called("GUI.ShowNotification") != 1 {
+		t.Fatalf("Invalid routing: %v %v", living.calls, bedroom.calls)
+	}
+
+	// The alerts already shown are not shown again
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", AlertsPath, strings.NewReader(alertsWebhookMessage)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Invalid status: %d %s", w.Code, w.Body.String())
+	}
+	if living.called("GUI.ShowNotification") != 1 || bedroom.called("GUI.ShowNotification") != 1 {
+		t.Fatalf("Alerts shown twice: %v %v", living.calls, bedroom.calls)
+	}
+
+	bedroom.respond("GUI.ShowNotification", `{"error":{"code":-32100,"message":"Failed to execute method."},"id":1,"jsonrpc":"2.0"}`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", AlertsPath, strings.NewReader(strings.Replace(alertsWebhookMessage, "BackupFailed", "DiskFull", 1))))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Failed notification should be retried: %d", w.Code)
+	}
+	if counter := counterValue(t, r.notifications.WithLabelValues(defaultAlertTarget, "error")); counter != 1 {
+		t.Fatalf("Invalid failed notifications: %f", counter)
+	}
+}
+
+func TestAlertsReceiverPartialFailure(t *testing.T) {
+	living := &kodiRecorder{responses: map[string]string{
+		"GUI.ShowNotification": `{"error":{"code":-32100,"message":"Failed to execute method."},"id":1,"jsonrpc":"2.0"}`,
+	}}
+	livingServer := httptest.NewServer(living)
+	defer livingServer.Close()
+	bedroom := &kodiRecorder{}
+	bedroomServer := httptest.NewServer(bedroom)
+	defer bedroomServer.Close()
+	client, err := kodi.NewClient(bedroomServer.URL, "", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	r, err := NewAlertsReceiver(AlertsOptions{
+		Client: client,
+		Config: AlertsConfig{
+			Targets: map[string]AlertTargetConfig{
+				"living-room": {URI: livingServer.URL},
+			},
+			Routes: []AlertRouteConfig{
+				{Targets: []string{"living-room", defaultAlertTarget}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The alerts are shown in the bedroom only: they are retried
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", AlertsPath, strings.NewReader(alertsWebhookMessage)))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Failed notification should be retried: %d", w.Code)
+	}
+	if living.called("GUI.ShowNotification") != 2 || bedroom.called("GUI.ShowNotification") != 2 {
+		t.Fatalf("Invalid routing: %v %v", living.calls, bedroom.calls)
+	}
+	if counter := counterValue(t, r.notifications.WithLabelValues("living-room", "error")); counter != 2 {
+		t.Fatalf("Invalid failed notifications: %f", counter)
+	}
+
+	// The retry only shows the alerts in the living room
+	living.respond("GUI.ShowNotification", `{"id":1,"jsonrpc":"2.0","result":"OK"}`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", AlertsPath, strings.NewReader(alertsWebhookMessage)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Invalid status: %d %s", w.Code, w.Body.String())
+	}
+	if living.called("GUI.ShowNotification") != 4 || bedroom.called("GUI.ShowNotification") != 2 {
+		t.Fatalf("Alerts shown twice: %v %v", living.calls, bedroom.calls)
+	}
+
+	// The alerts are shown again once the retry window is over
+	if err := r.notify(&alert{Status: "firing", Labels: map[string]string{"alertname": "BackupFailed", "severity": "critical"}}, time.Now().Add(alertRetryWindow)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if living.called("GUI.ShowNotification") != 5 || bedroom.called("GUI.ShowNotification") != 3 {
+		t.Fatalf("Alert not shown again: %v %v", living.calls, bedroom.calls)
+	}
+}
+
+func TestInvalidAlertsConfig(t *testing.T) {
+	for _, config := range []AlertsConfig{
+		{Title: "{{ .Labels.alertname "},
+		{Targets: map[string]AlertTargetConfig{"bedroom": {}}},
+		{Routes: []AlertRouteConfig{{Targets: []string{"kitchen"}}}},
+		{DisplayTime: time.Second},
+		{DisplayTime: -time.Second},
+	} {
+		if _, err := NewAlertsReceiver(AlertsOptions{
+			Client: newTestClient(t, "http://kodi:8080"),
+			Config: config,
+		}); err == nil {
+			t.Fatalf("Invalid alerts configuration accepted: %v", config)
+		}
+	}
+	if _, err := NewAlertsReceiver(AlertsOptions{}); err == nil {
+		t.Fatalf("Alerts receiver without client accepted")
+	}
+}
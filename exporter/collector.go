@@ -0,0 +1,120 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var scrapeCollectorSuccess = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "scrape", "collector_success"),
+	"Whether a collector succeeded.",
+	labelNames("collector"), nil,
+)
+
+// Collector collects a part of the metrics of the Kodi server
+type Collector interface {
+	// Update sends the metrics to ch. It returns an error if some metrics
+	// couldn't be collected.
+	Update(ch chan<- prometheus.Metric) error
+}
+
+// collectorFunc is a function used as a Collector
+type collectorFunc func(ch chan<- prometheus.Metric) error
+
+// Update implements Collector.
+func (f collectorFunc) Update(ch chan<- prometheus.Metric) error {
+	return f(ch)
+}
+
+// collectorFactory returns the collector of an exporter
+type collectorFactory func(e *Exporter) Collector
+
+// CollectorInfo describes a registered collector
+type CollectorInfo struct {
+	Name           string
+	DefaultEnabled bool
+	Help           string
+}
+
+var (
+	factories      = map[string]collectorFactory{}
+	collectorInfos = map[string]CollectorInfo{}
+)
+
+// registerCollector adds a collector to the registry. It is called from the
+// init functions.
+func registerCollector(name string, isDefaultEnabled bool, factory collectorFactory, help string) {
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("Collector %s registered twice", name))
+	}
+	factories[name] = factory
+	collectorInfos[name] = CollectorInfo{Name: name, DefaultEnabled: isDefaultEnabled, Help: help}
+}
+
+// collectorNames returns the names of the registered collectors, sorted
+func collectorNames() []string {
+	names := []string{}
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisteredCollectors returns the registered collectors, sorted by name
+func RegisteredCollectors() []CollectorInfo {
+	infos := []CollectorInfo{}
+	for _, name := range collectorNames() {
+		infos = append(infos, collectorInfos[name])
+	}
+	return infos
+}
+
+// enabledCollectors returns the state of the collectors: their default
+// state, overridden by the options, then by the configuration
+func enabledCollectors(states map[string]bool, overrides map[string]bool) map[string]bool {
+	enabled := map[string]bool{}
+	for name, info := range collectorInfos {
+		enabled[name] = info.DefaultEnabled
+		if state, ok := states[name]; ok {
+			enabled[name] = state
+		}
+		if state, ok := overrides[name]; ok {
+			enabled[name] = state
+		}
+	}
+	return enabled
+}
+
+// subCollector is an enabled collector of the exporter
+type subCollector struct {
+	name      string
+	collector Collector
+}
+
+// subCollectors returns the enabled collectors, in collection order
+func (e *Exporter) subCollectors() []subCollector {
+	collectors := []subCollector{}
+	for _, name := range collectorNames() {
+		if e.collectors[name] {
+			collectors = append(collectors, subCollector{name, factories[name](e)})
+		}
+	}
+	return collectors
+}
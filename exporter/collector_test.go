@@ -0,0 +1,131 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricValues returns the values of the series of a metric, by labels:
+// name=value,name=value
+func metricValues(t *testing.T, metrics []prometheus.Metric, desc *prometheus.Desc) map[string]float64 {
+	values := map[string]float64{}
+	for _, metric := range metrics {
+		if metric.Desc() != desc {
+			continue
+		}
+		pb := &dto.Metric{}
+		if err := metric.Write(pb); err != nil {
+			t.Fatalf("%v", err)
+		}
+		labels := []string{}
+		for _, pair := range pb.Label {
+			labels = append(labels, pair.GetName()+"="+pair.GetValue())
+		}
+		key := strings.Join(labels, ",")
+		if _, ok := values[key]; ok {
+			t.Fatalf("Duplicated series of %s: %s", desc, key)
+		}
+		switch {
+		case pb.Gauge != nil:
+			values[key] = pb.Gauge.GetValue()
+		case pb.Counter != nil:
+			values[key] = pb.Counter.GetValue()
+		default:
+			values[key] = pb.Untyped.GetValue()
+		}
+	}
+	return values
+}
+
+func TestEnabledCollectors(t *testing.T) {
+	enabled := enabledCollectors(
+		map[string]bool{"addons": true, "video": false},
+		map[string]bool{"video": true, "pvr": false},
+	)
+	for name, state := range map[string]bool{
+		"audio":   true,
+		"video":   true,
+		"addons":  true,
+		"pvr":     false,
+		"sources": false,
+	} {
+		if enabled[name] != state {
+			t.Fatalf("Invalid state of %s: %v", name, enabled[name])
+		}
+	}
+}
+
+func TestScrapeCollectorSuccess(t *testing.T) {
+	h, _ := newKodiRPCServer(t, map[string]string{
+		"JSONRPC.Ping":       `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+		"XBMC.GetInfoLabels": `{"id":1,"jsonrpc":"2.0","result":{"System.FPS":"60.00"}}`,
+		"PVR.GetProperties":  `{"error":{"code":-32100,"message":"Failed to execute method."},"id":1,"jsonrpc":"2.0"}`,
+	})
+	defer h.Close()
+	e, err := New(Options{
+		Client:     newTestClient(t, h.URL),
+		Collectors: map[string]bool{"audio": false, "video": false},
+		Config:     &Config{Collectors: map[string]bool{"genres": false}},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		e.Collect(ch)
+	})
+	success := map[string]float64{}
+	for _, metric := range metrics {
+		if metric.Desc() != scrapeCollectorSuccess {
+			continue
+		}
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			t.Fatalf("%v", err)
+		}
+		success[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+	}
+	if _, ok := success["audio"]; ok {
+		t.Fatalf("Disabled collector should not be reported: %v", success)
+	}
+	if success["system"] != 1 || success["storage"] != 1 {
+		t.Fatalf("Collectors should succeed: %v", success)
+	}
+	if success["pvr"] != 1 {
+		t.Fatalf("Unavailable PVR is not a failure: %v", success)
+	}
+	if success["library_scan"] != 0 || success["player"] != 0 {
+		t.Fatalf("Collectors should fail: %v", success)
+	}
+}
+
+func TestUnknownCollector(t *testing.T) {
+	for _, content := range []string{
+		"collectors:\n  players: true\n",
+		"refresh_intervals:\n  audio: 1h\n  players: 5s\n",
+	} {
+		filename := writeConfig(t, content)
+		defer os.Remove(filename)
+		if _, err := LoadConfig(filename); err == nil {
+			t.Fatalf("Unknown collector accepted: %s", content)
+		}
+	}
+}
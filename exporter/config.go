@@ -0,0 +1,340 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron"
+	"gopkg.in/yaml.v2"
+)
+
+// Config defines the configuration file of the exporter
+type Config struct {
+	InfoMetrics []InfoMetricConfig  `yaml:"info_metrics,omitempty"`
+	RPCMetrics  []RPCMetricsConfig  `yaml:"rpc_metrics,omitempty"`
+	Maintenance []MaintenanceConfig `yaml:"maintenance,omitempty"`
+	ScreenTime  *ScreenTimeConfig   `yaml:"screen_time,omitempty"`
+	Alerts      *AlertsConfig       `yaml:"alerts,omitempty"`
+	// Labels are added to all the metrics, overriding the flags
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Instance is the kodi_instance label, overriding the flags
+	Instance string `yaml:"instance,omitempty"`
+	// SeriesLimits are the maximum numbers of series by metric, overriding
+	// the flags
+	SeriesLimits map[string]int `yaml:"series_limits,omitempty"`
+	// Collectors enable or disable collectors, overriding the flags
+	Collectors map[string]bool `yaml:"collectors,omitempty"`
+	// RefreshIntervals are the minimum refresh intervals by collector
+	RefreshIntervals map[string]time.Duration `yaml:"refresh_intervals,omitempty"`
+}
+
+// InfoMetricConfig defines a metric computed from an InfoLabel or an
+// InfoBoolean
+type InfoMetricConfig struct {
+	InfoLabel   string `yaml:"infolabel,omitempty"`
+	InfoBoolean string `yaml:"infoboolean,omitempty"`
+	Name        string `yaml:"name"`
+	Help        string `yaml:"help,omitempty"`
+	Type        string `yaml:"type,omitempty"`
+	Parser      string `yaml:"parser,omitempty"`
+	Label       string `yaml:"label,omitempty"`
+}
+
+// RPCMetricsConfig defines metrics extracted from the result of a JSONRPC
+// call
+type RPCMetricsConfig struct {
+	Method  string                 `yaml:"method"`
+	Params  map[string]interface{} `yaml:"params,omitempty"`
+	Metrics []RPCMetricConfig      `yaml:"metrics"`
+}
+
+// RPCMetricConfig defines a metric extracted from a JSONRPC result using
+// JSONPath selectors. Each item selected by Each produces a sample.
+type RPCMetricConfig struct {
+	Name   string            `yaml:"name"`
+	Help   string            `yaml:"help,omitempty"`
+	Type   string            `yaml:"type,omitempty"`
+	Each   string            `yaml:"each,omitempty"`
+	Value  string            `yaml:"value,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// MaintenanceConfig defines a library maintenance job, run using a cron
+// schedule ("0 4 * * *")
+type MaintenanceConfig struct {
+	Name     string `yaml:"name"`
+	Action   string `yaml:"action"`
+	Schedule string `yaml:"schedule"`
+}
+
+// ScreenTimeConfig defines the daily screen time budgets of the Kodi
+// profiles. A warning is shown when the remaining time is below Warning.
+type ScreenTimeConfig struct {
+	StateFile string                   `yaml:"state_file,omitempty"`
+	Interval  time.Duration            `yaml:"interval,omitempty"`
+	Warning   time.Duration            `yaml:"warning,omitempty"`
+	Budgets   []ScreenTimeBudgetConfig `yaml:"budgets"`
+}
+
+// ScreenTimeBudgetConfig defines the screen time budget of a profile. During
+// the quiet hours ("21:00-07:00"), the budget is considered exceeded.
+type ScreenTimeBudgetConfig struct {
+	Profile    string        `yaml:"profile"`
+	Daily      time.Duration `yaml:"daily,omitempty"`
+	QuietHours string        `yaml:"quiet_hours,omitempty"`
+	Stop       bool          `yaml:"stop,omitempty"`
+}
+
+// AlertsConfig defines how the alerts received from Alertmanager are shown
+// as Kodi notifications. Title and Message are templates of an alert.
+type AlertsConfig struct {
+	Title       string                       `yaml:"title,omitempty"`
+	Message     string                       `yaml:"message,omitempty"`
+	DisplayTime time.Duration                `yaml:"displaytime,omitempty"`
+	Icons       map[string]string            `yaml:"icons,omitempty"`
+	Targets     map[string]AlertTargetConfig `yaml:"targets,omitempty"`
+	Routes      []AlertRouteConfig           `yaml:"routes,omitempty"`
+}
+
+// AlertTargetConfig defines a Kodi server where the alerts are shown
+type AlertTargetConfig struct {
+	URI      string `yaml:"uri"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// AlertRouteConfig sends the alerts matching all the labels of Match to
+// some targets
+type AlertRouteConfig struct {
+	Match   map[string]string `yaml:"match,omitempty"`
+	Targets []string          `yaml:"targets"`
+}
+
+// LoadConfig reads and validates the configuration file
+func LoadConfig(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read configuration file: %s", err)
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("Can't parse configuration file %s: %s", filename, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %s: %s", filename, err)
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	names := map[string]bool{}
+	for _, metric := range c.InfoMetrics {
+		if err := metric.validate(); err != nil {
+			return err
+		}
+		names[metric.Name] = true
+	}
+	for _, call := range c.RPCMetrics {
+		if len(call.Method) == 0 {
+			return fmt.Errorf("Missing JSONRPC method")
+		}
+		if len(call.Metrics) == 0 {
+			return fmt.Errorf("Method %s: no metrics", call.Method)
+		}
+		for _, metric := range call.Metrics {
+			if err := metric.validate(); err != nil {
+				return fmt.Errorf("Method %s: %s", call.Method, err)
+			}
+			if names[metric.Name] {
+				return fmt.Errorf("Metric %s is declared twice", metric.Name)
+			}
+			names[metric.Name] = true
+		}
+	}
+	jobs := map[string]bool{}
+	for _, job := range c.Maintenance {
+		if err := job.validate(); err != nil {
+			return err
+		}
+		if jobs[job.Name] {
+			return fmt.Errorf("Maintenance job %s is declared twice", job.Name)
+		}
+		jobs[job.Name] = true
+	}
+	if c.ScreenTime != nil {
+		if err := c.ScreenTime.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Alerts != nil {
+		if err := c.Alerts.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateLabels(c.Labels); err != nil {
+		return err
+	}
+	for name, limit := range c.SeriesLimits {
+		if !metricNameRegexp.MatchString(name) {
+			return fmt.Errorf("Series limit of invalid metric name: %q", name)
+		}
+		if limit < 0 {
+			return fmt.Errorf("Invalid series limit of %s: %d", name, limit)
+		}
+	}
+	for name := range c.Collectors {
+		if _, ok := factories[name]; !ok {
+			return fmt.Errorf("Unknown collector %s", name)
+		}
+	}
+	for name, interval := range c.RefreshIntervals {
+		if _, ok := factories[name]; !ok {
+			return fmt.Errorf("Refresh interval of unknown collector %s", name)
+		}
+		if interval < 0 {
+			return fmt.Errorf("Invalid refresh interval of %s: %s", name, interval)
+		}
+	}
+	return nil
+}
+
+func (c *InfoMetricConfig) validate() error {
+	if !metricNameRegexp.MatchString(c.Name) {
+		return fmt.Errorf("Invalid metric name: %q", c.Name)
+	}
+	if (len(c.InfoLabel) == 0) == (len(c.InfoBoolean) == 0) {
+		return fmt.Errorf("Metric %s: one of infolabel or infoboolean is required", c.Name)
+	}
+	if _, ok := valueTypes[c.Type]; !ok {
+		return fmt.Errorf("Metric %s: invalid type %q", c.Name, c.Type)
+	}
+	if len(c.Label) > 0 {
+		if !labelNameRegexp.MatchString(c.Label) {
+			return fmt.Errorf("Metric %s: invalid label name %q", c.Name, c.Label)
+		}
+		if len(c.Parser) > 0 {
+			return fmt.Errorf("Metric %s: a parser can't be used with a label", c.Name)
+		}
+		return nil
+	}
+	if len(c.InfoBoolean) > 0 {
+		if len(c.Parser) > 0 && c.Parser != boolParser {
+			return fmt.Errorf("Metric %s: InfoBooleans only support the %s parser", c.Name, boolParser)
+		}
+		return nil
+	}
+	if _, ok := valueParsers[c.Parser]; !ok {
+		return fmt.Errorf("Metric %s: invalid parser %q", c.Name, c.Parser)
+	}
+	return nil
+}
+
+func (c *RPCMetricConfig) validate() error {
+	if !metricNameRegexp.MatchString(c.Name) {
+		return fmt.Errorf("Invalid metric name: %q", c.Name)
+	}
+	if _, ok := valueTypes[c.Type]; !ok {
+		return fmt.Errorf("Metric %s: invalid type %q", c.Name, c.Type)
+	}
+	for _, path := range []string{c.Each, c.Value} {
+		if len(path) == 0 {
+			continue
+		}
+		if _, err := parseJSONPath(path); err != nil {
+			return fmt.Errorf("Metric %s: %s", c.Name, err)
+		}
+	}
+	for label, path := range c.Labels {
+		if !labelNameRegexp.MatchString(label) {
+			return fmt.Errorf("Metric %s: invalid label name %q", c.Name, label)
+		}
+		if _, err := parseJSONPath(path); err != nil {
+			return fmt.Errorf("Metric %s: %s", c.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *MaintenanceConfig) validate() error {
+	if len(c.Name) == 0 {
+		return fmt.Errorf("Missing maintenance job name")
+	}
+	if _, ok := maintenanceActions[c.Action]; !ok {
+		return fmt.Errorf("Maintenance job %s: invalid action %q", c.Name, c.Action)
+	}
+	if _, err := cron.ParseStandard(c.Schedule); err != nil {
+		return fmt.Errorf("Maintenance job %s: invalid schedule %q: %s", c.Name, c.Schedule, err)
+	}
+	return nil
+}
+
+func (c *ScreenTimeConfig) validate() error {
+	if c.Interval < 0 || c.Warning < 0 {
+		return fmt.Errorf("Screen time: invalid interval or warning")
+	}
+	profiles := map[string]bool{}
+	for _, budget := range c.Budgets {
+		if len(budget.Profile) == 0 {
+			return fmt.Errorf("Screen time: missing profile")
+		}
+		if profiles[budget.Profile] {
+			return fmt.Errorf("Screen time: profile %s is declared twice", budget.Profile)
+		}
+		profiles[budget.Profile] = true
+		if budget.Daily < 0 {
+			return fmt.Errorf("Screen time of %s: invalid daily budget %s", budget.Profile, budget.Daily)
+		}
+		if budget.Daily == 0 && len(budget.QuietHours) == 0 {
+			return fmt.Errorf("Screen time of %s: a daily budget or quiet hours are required", budget.Profile)
+		}
+		if len(budget.QuietHours) > 0 {
+			if _, err := parseQuietHours(budget.QuietHours); err != nil {
+				return fmt.Errorf("Screen time of %s: %s", budget.Profile, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *AlertsConfig) validate() error {
+	for name, text := range map[string]string{"title": c.Title, "message": c.Message} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("Alerts: invalid %s template: %s", name, err)
+		}
+	}
+	if c.DisplayTime < 0 || (c.DisplayTime > 0 && c.DisplayTime < minAlertDisplayTime) {
+		return fmt.Errorf("Alerts: invalid displaytime %s, at least %s expected", c.DisplayTime, minAlertDisplayTime)
+	}
+	for name, target := range c.Targets {
+		if len(target.URI) == 0 {
+			return fmt.Errorf("Alerts: missing URI of target %s", name)
+		}
+	}
+	for i, route := range c.Routes {
+		if len(route.Targets) == 0 {
+			return fmt.Errorf("Alerts: route %d has no targets", i+1)
+		}
+		for _, target := range route.Targets {
+			if _, ok := c.Targets[target]; !ok && target != defaultAlertTarget {
+				return fmt.Errorf("Alerts: route %d: unknown target %s", i+1, target)
+			}
+		}
+	}
+	return nil
+}
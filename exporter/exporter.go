@@ -0,0 +1,468 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	namespace = "kodi"
+)
+
+var (
+	up = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "up"),
+		"Was the last query of Kodi successful.",
+		nil, nil,
+	)
+	artistCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "audio_artists"),
+		"How many artists are in the audio library.",
+		nil, nil,
+	)
+	albumCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "audio_albums"),
+		"How many albums are in the audio library.",
+		nil, nil,
+	)
+	songCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "audio_songs"),
+		"How many songs are in the audio library.",
+		nil, nil,
+	)
+	movieCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "video_movies"),
+		"How many movies are in the video library.",
+		nil, nil,
+	)
+	tvshowCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "video_tvshows"),
+		"How many TV shows are in the video library.",
+		nil, nil,
+	)
+	// movieGenres = prometheus.NewDesc(
+	// 	prometheus.BuildFQName(namespace, "", "video_movies_genres"),
+	// 	"Genres for movies in the video library.",
+	// 	nil, nil,
+	// )
+	// tvshowGenres = prometheus.NewDesc(
+	// 	prometheus.BuildFQName(namespace, "", "video_tvshows_genres"),
+	// 	"Genres for TV shows in the video library.",
+	// 	nil, nil,
+	// )
+	// movieGenres = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	// 	Namespace: namespace,
+	// 	Name:      "video_movies_genres",
+	// 	Help:      "Genres for movies in the video library.",
+	// }, []string{"label"})
+	// tvshowGenres = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	// 	Namespace: namespace,
+	// 	Name:      "video_tvshows_genres",
+	// 	Help:      "Genres for TV shows in the video library.",
+	// }, []string{"label"})
+)
+
+// Options are the options of an Exporter
+type Options struct {
+	// Client queries the Kodi server. It is required.
+	Client *kodi.Client
+	// Collectors enable or disable collectors, by name. The other
+	// collectors keep their default state.
+	Collectors map[string]bool
+	// ConstLabels are added to all the metrics of the exporter. The labels
+	// of the configuration override them.
+	ConstLabels prometheus.Labels
+	// SeriesLimit is the maximum number of series of a metric, the others
+	// being folded into an "other" series. 0 disables the limit. The limits
+	// of the configuration override it, by metric.
+	SeriesLimit int
+	// InstanceLabel adds the kodi_instance label to all the metrics, using
+	// the name of the Kodi device, resolved once Connect reaches Kodi
+	InstanceLabel bool
+	// Instance is the kodi_instance label added to all the metrics. The
+	// name of the Kodi device is not resolved if it is set.
+	Instance string
+	// Logger defaults to the base logger
+	Logger log.Logger
+	// Config declares the custom metrics, the enabled collectors and their
+	// refresh intervals. It overrides Collectors.
+	Config *Config
+	// SourcesTimeout is the timeout of the media sources probes. It
+	// defaults to 5 seconds.
+	SourcesTimeout time.Duration
+	// PollInterval enables the background polling: Collect serves the
+	// metrics cached by the polling, and drops those older than Staleness
+	PollInterval time.Duration
+	Staleness    time.Duration
+	// ResyncInterval is the refresh interval of the library collectors while
+	// the library changes are notified by Kodi
+	ResyncInterval time.Duration
+}
+
+// Exporter collects Kodi stats from the given server and exports them using
+// the prometheus metrics package.
+type Exporter struct {
+	uri              string
+	client           *kodi.Client
+	logger           log.Logger
+	constLabels      prometheus.Labels
+	instanceLabel    bool
+	mu               sync.Mutex
+	instance         string
+	collector        prometheus.Collector
+	collectors       map[string]bool
+	limiter          *seriesLimiter
+	sourcesTimeout   time.Duration
+	pollInterval     time.Duration
+	staleness        time.Duration
+	refreshIntervals map[string]time.Duration
+	resyncInterval   time.Duration
+	events           *kodi.NotificationsListener
+	snapshots        snapshots
+	infoMetrics      *infoMetrics
+	rpcMetrics       []*rpcMetrics
+	libraryScans     *libraryScans
+	libraryChanges   *libraryChanges
+	status           *targetStatus
+}
+
+// New returns an initialized Exporter.
+func New(opts Options) (*Exporter, error) {
+	if opts.Client == nil {
+		return nil, fmt.Errorf("Kodi client not configured")
+	}
+	config := opts.Config
+	if config == nil {
+		config = &Config{}
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration: %s", err)
+	}
+	infoMetrics, err := newInfoMetrics(config.InfoMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid info metrics: %s", err)
+	}
+	rpcMetrics, err := newRPCMetrics(config.RPCMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid JSONRPC metrics: %s", err)
+	}
+	if err := validateLabels(opts.ConstLabels); err != nil {
+		return nil, err
+	}
+	constLabels := mergeLabels(opts.ConstLabels, config.Labels)
+	if err := validateCustomLabels(constLabels, infoMetrics, rpcMetrics); err != nil {
+		return nil, err
+	}
+	instance := strings.TrimSpace(opts.Instance)
+	if len(config.Instance) > 0 {
+		instance = strings.TrimSpace(config.Instance)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Base()
+	}
+	sourcesTimeout := opts.SourcesTimeout
+	if sourcesTimeout <= 0 {
+		sourcesTimeout = defaultSourcesTimeout
+	}
+
+	logger.Debugln("Init exporter")
+	uri := opts.Client.Address()
+	e := &Exporter{
+		uri:              uri,
+		client:           opts.Client,
+		logger:           logger,
+		constLabels:      constLabels,
+		instanceLabel:    opts.InstanceLabel || len(instance) > 0,
+		instance:         instance,
+		collectors:       enabledCollectors(opts.Collectors, config.Collectors),
+		limiter:          newSeriesLimiter(opts.SeriesLimit, config.SeriesLimits, logger),
+		sourcesTimeout:   sourcesTimeout,
+		pollInterval:     opts.PollInterval,
+		staleness:        opts.Staleness,
+		refreshIntervals: config.RefreshIntervals,
+		resyncInterval:   opts.ResyncInterval,
+		infoMetrics:      infoMetrics,
+		rpcMetrics:       rpcMetrics,
+		libraryScans:     newLibraryScans(logger),
+		libraryChanges:   newLibraryChanges(uri, logger),
+		status:           &targetStatus{target: uri},
+		snapshots:        snapshots{collectors: map[string]*snapshot{}, generations: map[string]uint64{}},
+	}
+	e.collector = e.Labelled(exporterCollector{e})
+	return e, nil
+}
+
+// Client returns the client of the Kodi server
+func (e *Exporter) Client() *kodi.Client {
+	return e.client
+}
+
+// Connect waits in background for the Kodi server to be reachable, checked
+// using JSONRPC.Ping every retryDelay. If notify is set, a notification is
+// shown on Kodi once connected.
+func (e *Exporter) Connect(retryDelay time.Duration, notify bool) {
+	go e.connect(retryDelay, notify)
+}
+
+func (e *Exporter) connect(retryDelay time.Duration, notify bool) {
+	for {
+		resp, err := e.client.Ping()
+		e.status.update(rpcError(err, resp.Error), time.Now())
+		if err == nil && resp.Error == nil {
+			break
+		}
+		e.logger.Warnf("Kodi API not available, retrying in %s: %v %v", retryDelay, err, resp.Error)
+		time.Sleep(retryDelay)
+	}
+	e.logger.Infof("Kodi API connection: %s", e.uri)
+	for !e.resolveInstance() {
+		time.Sleep(retryDelay)
+	}
+	if !notify {
+		return
+	}
+	resp, err := e.client.ShowNotification(
+		`Prometheus`, `Prometheus exporter for Kodi is ready`)
+	if err != nil || resp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+	}
+}
+
+// Describe describes all the metrics ever exported by the Kodi exporter.
+// It implements prometheus.Collector.
+// The kodi_instance label is only known once Kodi is reached, so the metrics
+// are described using a placeholder instance until this label is resolved.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.collector.Describe(ch)
+}
+
+// Collect fetches the stats from configured Kodi location and delivers them
+// as Prometheus metrics.
+// It implements prometheus.Collector.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.collector.Collect(ch)
+}
+
+// exporterCollector collects the metrics of an Exporter, without the const
+// labels
+type exporterCollector struct {
+	e *Exporter
+}
+
+func (c exporterCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.e.describe(ch)
+}
+
+func (c exporterCollector) Collect(ch chan<- prometheus.Metric) {
+	c.e.collect(ch)
+}
+
+func (e *Exporter) describe(ch chan<- *prometheus.Desc) {
+	ch <- up
+	ch <- lastRefresh
+	ch <- scrapeCollectorSuccess
+	ch <- artistCount
+	ch <- albumCount
+	ch <- songCount
+	ch <- movieCount
+	ch <- tvshowCount
+	ch <- cpuUsage
+	ch <- memoryUsed
+	ch <- cpuTemperature
+	ch <- gpuTemperature
+	ch <- uptime
+	ch <- totalUptime
+	ch <- fps
+	ch <- storageTotal
+	ch <- storageFree
+	ch <- storageUsed
+	ch <- addonsCount
+	ch <- addonsBroken
+	ch <- addonInfo
+	ch <- pvrAvailable
+	ch <- pvrRecording
+	ch <- pvrScanning
+	ch <- pvrChannelGroups
+	ch <- pvrChannels
+	ch <- pvrRecordings
+	ch <- pvrTimers
+	ch <- pvrNowPlaying
+	ch <- pvrNextProgram
+	ch <- pvrProgramProgress
+	ch <- sourceUp
+	ch <- sourceProbeDuration
+	ch <- libraryItemsBySource
+	ch <- libraryItemsByProtocol
+	e.limiter.describe(ch)
+	e.libraryScans.describe(ch)
+	e.libraryChanges.describe(ch)
+	// ch <- movieGenres
+	// ch <- tvshowGenres
+	e.infoMetrics.describe(ch)
+	for _, call := range e.rpcMetrics {
+		for _, metric := range call.metrics {
+			ch <- metric.desc
+		}
+	}
+}
+
+func (e *Exporter) collect(ch chan<- prometheus.Metric) {
+	e.logger.Infof("Kodi exporter starting")
+	e.limiter.collect(ch)
+	if e.pollInterval > 0 {
+		e.collectSnapshots(ch, time.Now())
+		return
+	}
+	if !e.ping(ch) {
+		return
+	}
+	now := time.Now()
+	for _, c := range e.subCollectors() {
+		e.refreshCollector(c, now).collect(ch, c.name)
+	}
+	e.logger.Infof("Kodi exporter finished")
+}
+
+// ping checks if Kodi is up
+func (e *Exporter) ping(ch chan<- prometheus.Metric) bool {
+	resp, err := e.client.Ping()
+	e.status.update(rpcError(err, resp.Error), time.Now())
+	if err != nil || resp.Error != nil {
+		ch <- prometheus.MustNewConstMetric(
+			up, prometheus.GaugeValue, 0,
+		)
+		e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+		return false
+	}
+	e.logger.Infof("Ping: %s", resp.Result)
+	ch <- prometheus.MustNewConstMetric(
+		up, prometheus.GaugeValue, 1,
+	)
+	return true
+}
+
+func (e *Exporter) collectAudioMetrics(ch chan<- prometheus.Metric) error {
+	var lastErr error
+	artistsResp, err := e.client.AudioGetArtists()
+	if err != nil || artistsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, artistsResp.Error)
+		lastErr = rpcError(err, artistsResp.Error)
+	} else {
+		//size := float64(len(artistsResp.Result.Artists))
+		size := float64(artistsResp.Result.Limits.Total)
+		ch <- prometheus.MustNewConstMetric(
+			artistCount, prometheus.GaugeValue, size,
+		)
+		e.logger.Infof("Artists: %d", size)
+	}
+
+	albumsResp, err := e.client.AudioGetAlbums()
+	if err != nil || albumsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, albumsResp.Error)
+		lastErr = rpcError(err, albumsResp.Error)
+	} else {
+		//size := float64(len(albumsResp.Result.Albums))
+		size := float64(albumsResp.Result.Limits.Total)
+		ch <- prometheus.MustNewConstMetric(
+			albumCount, prometheus.GaugeValue, size,
+		)
+		e.logger.Infof("Albums: %d", size)
+	}
+
+	songsResp, err := e.client.AudioGetSongs()
+	if err != nil || songsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, songsResp.Error)
+		lastErr = rpcError(err, songsResp.Error)
+	} else {
+		//size := float64(len(songsResp.Result.Songs))
+		size := float64(songsResp.Result.Limits.Total)
+		ch <- prometheus.MustNewConstMetric(
+			songCount, prometheus.GaugeValue, size,
+		)
+		e.logger.Infof("Songs: %d", size)
+	}
+	return lastErr
+}
+
+func (e *Exporter) collectVideoMetrics(ch chan<- prometheus.Metric) error {
+	var lastErr error
+	moviesResp, err := e.client.VideoGetMovies()
+	if err != nil || moviesResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, moviesResp.Error)
+		lastErr = rpcError(err, moviesResp.Error)
+	} else {
+		//size := float64(len(moviesResp.Result.Movies))
+		size := float64(moviesResp.Result.Limits.Total)
+		ch <- prometheus.MustNewConstMetric(
+			movieCount, prometheus.GaugeValue, size,
+		)
+		e.logger.Infof("Movies: %d", size)
+	}
+
+	tvshowsResp, err := e.client.VideoGetTVShows()
+	if err != nil || tvshowsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, tvshowsResp.Error)
+		lastErr = rpcError(err, tvshowsResp.Error)
+	} else {
+		//size := float64(len(tvshowsResp.Result.Movies))
+		size := float64(tvshowsResp.Result.Limits.Total)
+		ch <- prometheus.MustNewConstMetric(
+			tvshowCount, prometheus.GaugeValue, size,
+		)
+		e.logger.Infof("TV Shows: %d", size)
+	}
+	return lastErr
+}
+
+func (e *Exporter) collectGenresMetrics(ch chan<- prometheus.Metric) error {
+	var lastErr error
+	moviesGenresResp, err := e.client.VideoGetMoviesGenres()
+	if err != nil || moviesGenresResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, moviesGenresResp.Error)
+		lastErr = rpcError(err, moviesGenresResp.Error)
+	} else {
+		e.logger.Infof("Movies Genres: %v", moviesGenresResp.Result)
+	}
+	tvshowsGenresResp, err := e.client.VideoGetTVShowsGenres()
+	if err != nil || tvshowsGenresResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, tvshowsGenresResp.Error)
+		lastErr = rpcError(err, tvshowsGenresResp.Error)
+	} else {
+		e.logger.Infof("TV Shows Genres: %v", tvshowsGenresResp.Result)
+	}
+	return lastErr
+}
+
+func init() {
+	registerCollector("audio", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectAudioMetrics)
+	}, "Export the audio library metrics.")
+	registerCollector("video", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectVideoMetrics)
+	}, "Export the video library metrics.")
+	registerCollector("genres", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectGenresMetrics)
+	}, "Query the genres of the video library.")
+}
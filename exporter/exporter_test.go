@@ -0,0 +1,208 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	logrus "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+func init() {
+	logrus.SetLevel(logrus.DebugLevel)
+}
+
+type kodiserver struct {
+	*httptest.Server
+}
+
+func newKodiServer(resp string) *kodiserver {
+	h := &kodiserver{}
+	h.Server = httptest.NewServer(handler(h, resp))
+	return h
+}
+
+func handler(ks *kodiserver, resp string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(resp))
+	}
+}
+
+func newTestClient(t *testing.T, uri string) *kodi.Client {
+	client, err := kodi.NewClient(uri, "", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return client
+}
+
+// kodiRecorder is a Kodi server which answers the JSONRPC calls using the
+// responses by method, and records the calls. The other methods succeed, or
+// are not found if strict is set. The responses are delayed by delay.
+type kodiRecorder struct {
+	mu        sync.Mutex
+	responses map[string]string
+	strict    bool
+	delay     time.Duration
+	calls     []string
+}
+
+func (k *kodiRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &kodi.Request{}
+	json.NewDecoder(r.Body).Decode(req)
+	time.Sleep(k.delay)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.calls = append(k.calls, req.Method)
+	resp, ok := k.responses[req.Method]
+	switch {
+	case ok:
+	case k.strict:
+		resp = `{"error":{"code":-32601,"message":"Method not found."},"id":1,"jsonrpc":"2.0"}`
+	default:
+		resp = `{"id":1,"jsonrpc":"2.0","result":"OK"}`
+	}
+	w.Write([]byte(resp))
+}
+
+// respond changes the response to a method
+func (k *kodiRecorder) respond(method string, resp string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.responses == nil {
+		k.responses = map[string]string{}
+	}
+	k.responses[method] = resp
+}
+
+func (k *kodiRecorder) called(method string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	count := 0
+	for _, call := range k.calls {
+		if call == method {
+			count++
+		}
+	}
+	return count
+}
+
+// newKodiRPCServer returns a Kodi server which answers the JSONRPC calls
+// using the responses by method. The other methods are not found.
+func newKodiRPCServer(t *testing.T, responses map[string]string) (*httptest.Server, *kodi.Client) {
+	h := httptest.NewServer(&kodiRecorder{responses: responses, strict: true})
+	return h, newTestClient(t, h.URL)
+}
+
+func TestKodiExporter(t *testing.T) {
+	h := newKodiServer(`{"id":1,"jsonrpc":"2.0","result":"pong"}`)
+	defer h.Close()
+
+	collector, err := New(Options{Client: newTestClient(t, h.URL)})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		defer close(ch)
+		collector.Collect(ch)
+	}()
+}
+
+func TestKodiExporterWithKodiDown(t *testing.T) {
+	h := newKodiServer(``)
+	h.Close()
+
+	collector, err := New(Options{Client: newTestClient(t, h.URL)})
+	if err != nil {
+		t.Fatalf("Exporter should start without Kodi: %v", err)
+	}
+	ch := make(chan prometheus.Metric, 10)
+	collector.Collect(ch)
+	close(ch)
+	metrics := []prometheus.Metric{}
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) != 1 || metrics[0].Desc() != up {
+		t.Fatalf("Only kodi_up should be exported: %v", metrics)
+	}
+	pb := &dto.Metric{}
+	metrics[0].Write(pb)
+	if pb.Gauge.GetValue() != 0 {
+		t.Fatalf("Kodi should be down: %v", pb)
+	}
+}
+
+func TestKodiExporterConnect(t *testing.T) {
+	recorder := &kodiRecorder{responses: map[string]string{
+		"JSONRPC.Ping": `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+	}}
+	h := httptest.NewServer(recorder)
+	defer h.Close()
+
+	collector, err := New(Options{Client: newTestClient(t, h.URL)})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	collector.connect(time.Millisecond, false)
+	if recorder.called("JSONRPC.Ping") != 1 || recorder.called("GUI.ShowNotification") != 0 {
+		t.Fatalf("The notification should be opt-in: %v", recorder.calls)
+	}
+	collector.connect(time.Millisecond, true)
+	if recorder.called("GUI.ShowNotification") != 1 {
+		t.Fatalf("Missing startup notification: %v", recorder.calls)
+	}
+}
+
+func TestNewExporterWithoutClient(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Fatalf("Exporter created without Kodi client")
+	}
+}
+
+func TestExporterConstLabels(t *testing.T) {
+	h := newKodiServer(``)
+	h.Close()
+
+	collector, err := New(Options{
+		Client:      newTestClient(t, h.URL),
+		ConstLabels: prometheus.Labels{"room": "living"},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		collector.Collect(ch)
+	})
+	if len(metrics) != 1 {
+		t.Fatalf("Only kodi_up should be exported: %v", metrics)
+	}
+	pb := &dto.Metric{}
+	metrics[0].Write(pb)
+	if len(pb.Label) != 1 || pb.Label[0].GetName() != "room" || pb.Label[0].GetValue() != "living" {
+		t.Fatalf("Missing const labels: %v", pb)
+	}
+}
@@ -0,0 +1,397 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	// defaultHistoryInterval is the default polling interval of the players
+	defaultHistoryInterval = time.Minute
+)
+
+var (
+	historyBucket = []byte("sessions")
+	historyLabels = labelNames("media")
+
+	// Notifications sent by Kodi when the state of a player changes
+	playerNotifications = []string{
+		"Player.OnPlay",
+		"Player.OnAVStart",
+		"Player.OnPause",
+		"Player.OnResume",
+		"Player.OnStop",
+	}
+)
+
+// playbackSession is a playback recorded in the history
+type playbackSession struct {
+	ID      uint64    `json:"id"`
+	Target  string    `json:"target"`
+	Media   string    `json:"media"`
+	Title   string    `json:"title"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Watched float64   `json:"watched_seconds"`
+}
+
+// playback is the item played by a player, as observed on Kodi
+type playback struct {
+	PlayerID int
+	Media    string
+	Title    string
+	Playing  bool
+}
+
+func (p playback) key() string {
+	return fmt.Sprintf("%s/%s", p.Media, p.Title)
+}
+
+type activePlayback struct {
+	session *playbackSession
+	key     string
+	playing bool
+}
+
+// HistoryOptions are the options of a PlaybackHistory
+type HistoryOptions struct {
+	// Client queries the Kodi server. It is required.
+	Client *kodi.Client
+	// Filename is the database file where the sessions are recorded. It is
+	// required.
+	Filename string
+	// Interval is the polling interval of the players, 1 minute by default
+	Interval time.Duration
+	// Logger defaults to the base logger
+	Logger log.Logger
+}
+
+// PlaybackHistory tracks the playbacks of the players, polled in background
+// and on the player notifications, and records them in an embedded database.
+// The counters are restored from the database, so they survive the restarts
+// of the exporter.
+// It implements prometheus.Collector.
+type PlaybackHistory struct {
+	mu       sync.Mutex
+	client   *kodi.Client
+	target   string
+	interval time.Duration
+	maxGap   time.Duration
+	db       *bolt.DB
+	active   map[int]*activePlayback
+	watched  *prometheus.CounterVec
+	sessions *prometheus.CounterVec
+	logger   log.Logger
+	stopChan chan struct{}
+}
+
+// NewPlaybackHistory returns the history of the playbacks of the Kodi
+// server, recorded in a database file
+func NewPlaybackHistory(opts HistoryOptions) (*PlaybackHistory, error) {
+	if opts.Client == nil {
+		return nil, fmt.Errorf("Kodi client not configured")
+	}
+	interval := opts.Interval
+	if interval == 0 {
+		interval = defaultHistoryInterval
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Base()
+	}
+	h := newPlaybackHistory(opts.Client, interval, logger)
+	if err := h.open(opts.Filename); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// newPlaybackHistory returns the history of the playbacks of a Kodi server,
+// whose players are polled every interval. At most twice the interval is
+// counted between two observations, so the time during which the players
+// weren't observed isn't counted as watched.
+func newPlaybackHistory(client *kodi.Client, interval time.Duration, logger log.Logger) *PlaybackHistory {
+	return &PlaybackHistory{
+		client:   client,
+		target:   client.Address(),
+		interval: interval,
+		maxGap:   2 * interval,
+		logger:   logger,
+		stopChan: make(chan struct{}),
+		active:   map[int]*activePlayback{},
+		watched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "player",
+			Name:      "watch_seconds_total",
+			Help:      "How long the media were played.",
+		}, historyLabels),
+		sessions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "player",
+			Name:      "sessions_total",
+			Help:      "How many playback sessions were started.",
+		}, historyLabels),
+	}
+}
+
+func sessionKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// open opens the database, and restores the counters from the sessions
+// recorded for the target
+func (h *PlaybackHistory) open(filename string) error {
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("Can't open history database %s: %s", filename, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(historyBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			session := &playbackSession{}
+			if err := json.Unmarshal(v, session); err != nil {
+				return err
+			}
+			if session.Target == h.target {
+				h.sessions.WithLabelValues(session.Media).Inc()
+				h.watched.WithLabelValues(session.Media).Add(session.Watched)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("Can't read history database %s: %s", filename, err)
+	}
+	h.db = db
+	return nil
+}
+
+// Start polls the players in background
+func (h *PlaybackHistory) Start() {
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			h.poll()
+			select {
+			case <-h.stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the polling
+func (h *PlaybackHistory) Stop() {
+	close(h.stopChan)
+}
+
+// Close finishes the active sessions, and closes the database
+func (h *PlaybackHistory) Close() error {
+	h.interrupt(time.Now())
+	return h.db.Close()
+}
+
+// save records a session, allocating its ID for a new session
+func (h *PlaybackHistory) save(session *playbackSession) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		if session.ID == 0 {
+			id, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			session.ID = id
+		}
+		content, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(sessionKey(session.ID), content)
+	})
+}
+
+// update records the playbacks observed at a given time. The time elapsed
+// since the previous observation is counted if the item was playing.
+func (h *PlaybackHistory) update(playbacks []playback, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	observed := map[int]playback{}
+	for _, p := range playbacks {
+		observed[p.PlayerID] = p
+	}
+	for playerID, active := range h.active {
+		p, ok := observed[playerID]
+		if !ok || p.key() != active.key {
+			h.record(active, now)
+			h.logger.Infof("Playback finished: %s %s (%.0fs)",
+				active.session.Media, active.session.Title, active.session.Watched)
+			delete(h.active, playerID)
+		}
+	}
+	for _, p := range playbacks {
+		active, ok := h.active[p.PlayerID]
+		if ok {
+			h.record(active, now)
+			active.playing = p.Playing
+			continue
+		}
+		active = &activePlayback{
+			session: &playbackSession{
+				Target: h.target,
+				Media:  p.Media,
+				Title:  p.Title,
+				Start:  now,
+				End:    now,
+			},
+			key:     p.key(),
+			playing: p.Playing,
+		}
+		h.active[p.PlayerID] = active
+		h.sessions.WithLabelValues(p.Media).Inc()
+		h.watched.WithLabelValues(p.Media)
+		h.logger.Infof("Playback started: %s %s", p.Media, p.Title)
+		if err := h.save(active.session); err != nil {
+			h.logger.Errorf("Can't save playback session: %s", err)
+		}
+	}
+}
+
+func (h *PlaybackHistory) record(active *activePlayback, now time.Time) {
+	session := active.session
+	if active.playing {
+		elapsed := now.Sub(session.End)
+		if elapsed > h.maxGap {
+			elapsed = h.maxGap
+		}
+		if elapsed > 0 {
+			session.Watched += elapsed.Seconds()
+			h.watched.WithLabelValues(session.Media).Add(elapsed.Seconds())
+		}
+	}
+	session.End = now
+	if err := h.save(session); err != nil {
+		h.logger.Errorf("Can't save playback session: %s", err)
+	}
+}
+
+// interrupt finishes the active sessions, when the players can't be observed
+func (h *PlaybackHistory) interrupt(now time.Time) {
+	h.update(nil, now)
+}
+
+// poll observes the items played by the active players. The active sessions
+// are finished if Kodi can't be reached.
+func (h *PlaybackHistory) poll() error {
+	playbacks, err := h.observe()
+	if err != nil {
+		h.interrupt(time.Now())
+		return err
+	}
+	h.update(playbacks, time.Now())
+	return nil
+}
+
+// observe returns the items played by the active players
+func (h *PlaybackHistory) observe() ([]playback, error) {
+	playersResp, err := h.client.PlayerGetActivePlayers()
+	if err != nil || playersResp.Error != nil {
+		h.logger.Errorf("Kodi error : %v %v", err, playersResp.Error)
+		return nil, rpcError(err, playersResp.Error)
+	}
+	playbacks := []playback{}
+	for _, player := range playersResp.Result {
+		if player.Type == "picture" {
+			continue
+		}
+		itemResp, err := h.client.PlayerGetItem(player.PlayerID)
+		if err != nil || itemResp.Error != nil {
+			h.logger.Errorf("Kodi error : %v %v", err, itemResp.Error)
+			return nil, rpcError(err, itemResp.Error)
+		}
+		propertiesResp, err := h.client.PlayerGetProperties(player.PlayerID)
+		if err != nil || propertiesResp.Error != nil {
+			h.logger.Errorf("Kodi error : %v %v", err, propertiesResp.Error)
+			return nil, rpcError(err, propertiesResp.Error)
+		}
+		playbacks = append(playbacks, playback{
+			PlayerID: player.PlayerID,
+			Media:    playbackMedia(player, itemResp.Result.Item),
+			Title:    playbackTitle(itemResp.Result.Item),
+			Playing:  propertiesResp.Result.Speed != 0,
+		})
+	}
+	return playbacks, nil
+}
+
+func playbackMedia(player kodi.Player, item kodi.PlayerItem) string {
+	if len(item.Type) == 0 || item.Type == "unknown" {
+		return player.Type
+	}
+	return item.Type
+}
+
+func playbackTitle(item kodi.PlayerItem) string {
+	title := item.Title
+	if len(title) == 0 {
+		title = item.Label
+	}
+	if len(item.ShowTitle) > 0 {
+		title = item.ShowTitle + " - " + title
+	}
+	return title
+}
+
+// Subscribe polls the players when Kodi notifies a change of their state
+func (h *PlaybackHistory) Subscribe(listener *kodi.NotificationsListener) {
+	for _, method := range playerNotifications {
+		listener.Subscribe(method, func(*kodi.Notification) {
+			h.poll()
+		})
+	}
+}
+
+// Describe describes the metrics of the history.
+// It implements prometheus.Collector.
+func (h *PlaybackHistory) Describe(ch chan<- *prometheus.Desc) {
+	h.watched.Describe(ch)
+	h.sessions.Describe(ch)
+}
+
+// Collect delivers the counters of the history.
+// It implements prometheus.Collector.
+func (h *PlaybackHistory) Collect(ch chan<- prometheus.Metric) {
+	h.watched.Collect(ch)
+	h.sessions.Collect(ch)
+}
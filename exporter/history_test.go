@@ -0,0 +1,206 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestPlaybackHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "history.db")
+
+	history := newPlaybackHistory(newTestClient(t, "http://kodi:8080"), 10*time.Minute, log.Base())
+	if err := history.open(filename); err != nil {
+		t.Fatalf("%v", err)
+	}
+	start := time.Date(2016, 7, 10, 20, 0, 0, 0, time.UTC)
+	movie := playback{PlayerID: 1, Media: "movie", Title: "Heat", Playing: true}
+	history.update([]playback{movie}, start)
+	history.update([]playback{movie}, start.Add(10*time.Minute))
+	// Paused during 5 minutes
+	movie.Playing = false
+	history.update([]playback{movie}, start.Add(20*time.Minute))
+	movie.Playing = true
+	history.update([]playback{movie}, start.Add(25*time.Minute))
+	// Next item on the same player
+	song := playback{PlayerID: 0, Media: "song", Title: "Dear Can", Playing: true}
+	history.update([]playback{{PlayerID: 1, Media: "movie", Title: "Ran", Playing: true}, song}, start.Add(30*time.Minute))
+	history.update(nil, start.Add(31*time.Minute))
+
+	if watched := counterValue(t, history.watched.WithLabelValues("movie")); watched != 26*60 {
+		t.Fatalf("Invalid movie watch time: %f", watched)
+	}
+	if sessions := counterValue(t, history.sessions.WithLabelValues("movie")); sessions != 2 {
+		t.Fatalf("Invalid movie sessions: %f", sessions)
+	}
+	if err := history.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Counters are restored from the database
+	restarted := newPlaybackHistory(newTestClient(t, "http://kodi:8080"), 10*time.Minute, log.Base())
+	if err := restarted.open(filename); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer restarted.Close()
+	if watched := counterValue(t, restarted.watched.WithLabelValues("movie")); watched != 26*60 {
+		t.Fatalf("Invalid restored movie watch time: %f", watched)
+	}
+	if sessions := counterValue(t, restarted.sessions.WithLabelValues("song")); sessions != 1 {
+		t.Fatalf("Invalid restored song sessions: %f", sessions)
+	}
+}
+
+func TestPlaybackHistoryPoll(t *testing.T) {
+	responses := map[string]string{
+		"Player.GetActivePlayers": `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`,
+		"Player.GetItem":          `{"id":1,"jsonrpc":"2.0","result":{"item":{"id":1,"label":"Uno","showtitle":"Better Call Saul","title":"Uno","type":"episode"}}}`,
+		"Player.GetProperties":    `{"id":1,"jsonrpc":"2.0","result":{"speed":0}}`,
+	}
+	h, client := newKodiRPCServer(t, responses)
+	defer h.Close()
+
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	history := newPlaybackHistory(client, time.Minute, log.Base())
+	if err := history.open(filepath.Join(dir, "history.db")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer history.Close()
+
+	if err := history.poll(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	active, ok := history.active[1]
+	if !ok {
+		t.Fatalf("Playback not tracked")
+	}
+	if active.session.Media != "episode" || active.session.Title != "Better Call Saul - Uno" || active.playing {
+		t.Fatalf("Invalid playback: %v %v", active.session, active.playing)
+	}
+}
+
+func TestPlaybackHistoryGap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	history := newPlaybackHistory(newTestClient(t, "http://kodi:8080"), time.Minute, log.Base())
+	if err := history.open(filepath.Join(dir, "history.db")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer history.Close()
+
+	start := time.Date(2016, 7, 10, 20, 0, 0, 0, time.UTC)
+	movie := playback{PlayerID: 1, Media: "movie", Title: "Heat", Playing: true}
+	history.update([]playback{movie}, start)
+	history.update([]playback{movie}, start.Add(time.Minute))
+	// The players weren't observed during 3 hours
+	history.update([]playback{movie}, start.Add(3*time.Hour))
+
+	if watched := counterValue(t, history.watched.WithLabelValues("movie")); watched != 3*60 {
+		t.Fatalf("Invalid movie watch time: %f", watched)
+	}
+}
+
+func TestPlaybackHistoryPollFailure(t *testing.T) {
+	responses := map[string]string{
+		"Player.GetActivePlayers": `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`,
+		"Player.GetItem":          `{"id":1,"jsonrpc":"2.0","result":{"item":{"id":1,"label":"Heat","title":"Heat","type":"movie"}}}`,
+		"Player.GetProperties":    `{"id":1,"jsonrpc":"2.0","result":{"speed":1}}`,
+	}
+	h, client := newKodiRPCServer(t, responses)
+
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	history := newPlaybackHistory(client, time.Minute, log.Base())
+	if err := history.open(filepath.Join(dir, "history.db")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer history.Close()
+
+	if err := history.poll(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, ok := history.active[1]; !ok {
+		t.Fatalf("Playback not tracked")
+	}
+	// Kodi is down: the session is finished
+	h.Close()
+	if err := history.poll(); err == nil {
+		t.Fatalf("No error while Kodi is down")
+	}
+	if len(history.active) != 0 {
+		t.Fatalf("Playback still tracked: %v", history.active)
+	}
+}
+
+func TestPlaybackHistoryPolling(t *testing.T) {
+	responses := map[string]string{
+		"Player.GetActivePlayers": `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`,
+		"Player.GetItem":          `{"id":1,"jsonrpc":"2.0","result":{"item":{"id":1,"label":"Heat","title":"Heat","type":"movie"}}}`,
+		"Player.GetProperties":    `{"id":1,"jsonrpc":"2.0","result":{"speed":1}}`,
+	}
+	h, client := newKodiRPCServer(t, responses)
+	defer h.Close()
+
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := NewPlaybackHistory(HistoryOptions{Filename: filepath.Join(dir, "history.db")}); err == nil {
+		t.Fatalf("History without client accepted")
+	}
+	history, err := NewPlaybackHistory(HistoryOptions{
+		Client:   client,
+		Filename: filepath.Join(dir, "history.db"),
+		Interval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer history.Close()
+
+	history.Start()
+	defer history.Stop()
+	for i := 0; i < 100 && counterValue(t, history.watched.WithLabelValues("movie")) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sessions := counterValue(t, history.sessions.WithLabelValues("movie")); sessions != 1 {
+		t.Fatalf("Invalid sessions: %f", sessions)
+	}
+	if watched := counterValue(t, history.watched.WithLabelValues("movie")); watched == 0 {
+		t.Fatalf("The watch time should be counted while polling")
+	}
+}
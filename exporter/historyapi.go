@@ -0,0 +1,280 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// HistoryPath is the path of the history API
+	HistoryPath         = "/api/v1/history"
+	historyDefaultLimit = 100
+	historyMaxLimit     = 1000
+	historyDayLayout    = "2006-01-02"
+)
+
+// sessionsQuery selects the sessions of the history. Zero values match all
+// the sessions.
+type sessionsQuery struct {
+	Target string
+	Media  string
+	Since  time.Time
+	Until  time.Time
+}
+
+func (q *sessionsQuery) match(session *playbackSession) bool {
+	if len(q.Target) > 0 && session.Target != q.Target {
+		return false
+	}
+	if len(q.Media) > 0 && session.Media != q.Media {
+		return false
+	}
+	if !q.Since.IsZero() && session.End.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !session.Start.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// query returns the sessions of the history, the most recent first
+func (h *PlaybackHistory) query(q *sessionsQuery) ([]playbackSession, error) {
+	sessions := []playbackSession{}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			session := playbackSession{}
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+			if q.match(&session) {
+				sessions = append(sessions, session)
+			}
+		}
+		return nil
+	})
+	return sessions, err
+}
+
+// historyDay aggregates the sessions started on a day
+type historyDay struct {
+	Day      string  `json:"day"`
+	Sessions int     `json:"sessions"`
+	Watched  float64 `json:"watched_seconds"`
+}
+
+// historyTitle aggregates the sessions of a title
+type historyTitle struct {
+	Title       string    `json:"title"`
+	Media       string    `json:"media"`
+	Sessions    int       `json:"sessions"`
+	Watched     float64   `json:"watched_seconds"`
+	LastWatched time.Time `json:"last_watched"`
+}
+
+func aggregateDays(sessions []playbackSession, location *time.Location) []historyDay {
+	days := map[string]*historyDay{}
+	for _, session := range sessions {
+		day := session.Start.In(location).Format(historyDayLayout)
+		aggregate, ok := days[day]
+		if !ok {
+			aggregate = &historyDay{Day: day}
+			days[day] = aggregate
+		}
+		aggregate.Sessions++
+		aggregate.Watched += session.Watched
+	}
+	result := []historyDay{}
+	for _, aggregate := range days {
+		result = append(result, *aggregate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Day < result[j].Day
+	})
+	return result
+}
+
+func aggregateTitles(sessions []playbackSession) []historyTitle {
+	titles := map[string]*historyTitle{}
+	for _, session := range sessions {
+		key := session.Media + "/" + session.Title
+		aggregate, ok := titles[key]
+		if !ok {
+			aggregate = &historyTitle{Title: session.Title, Media: session.Media}
+			titles[key] = aggregate
+		}
+		aggregate.Sessions++
+		aggregate.Watched += session.Watched
+		if session.End.After(aggregate.LastWatched) {
+			aggregate.LastWatched = session.End
+		}
+	}
+	result := []historyTitle{}
+	for _, aggregate := range titles {
+		result = append(result, *aggregate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Watched != result[j].Watched {
+			return result[i].Watched > result[j].Watched
+		}
+		return result[i].Title < result[j].Title
+	})
+	return result
+}
+
+// historyAPI is a read-only HTTP API over the playback history:
+//
+//	/api/v1/history         the sessions, the most recent first
+//	/api/v1/history/days    the sessions aggregated by day
+//	/api/v1/history/titles  the sessions aggregated by title
+//
+// The sessions are filtered using the target, media, since and until
+// parameters, and paginated using the limit and offset parameters.
+type historyAPI struct {
+	history  *PlaybackHistory
+	location *time.Location
+}
+
+// parseHistoryTime parses a RFC3339 time or a day
+func parseHistoryTime(value string, location *time.Location) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(historyDayLayout, value, location)
+}
+
+func parseHistoryInt(value string, defaultValue int) (int, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid number: %s", value)
+	}
+	return i, nil
+}
+
+func (api *historyAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	params := r.URL.Query()
+	query := &sessionsQuery{
+		Target: params.Get("target"),
+		Media:  params.Get("media"),
+	}
+	var err error
+	if query.Since, err = parseHistoryTime(params.Get("since"), api.location); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid since: %s", err))
+		return
+	}
+	if query.Until, err = parseHistoryTime(params.Get("until"), api.location); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid until: %s", err))
+		return
+	}
+	limit, err := parseHistoryInt(params.Get("limit"), historyDefaultLimit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %s", err))
+		return
+	}
+	if limit > historyMaxLimit {
+		limit = historyMaxLimit
+	}
+	offset, err := parseHistoryInt(params.Get("offset"), 0)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid offset: %s", err))
+		return
+	}
+
+	sessions, err := api.history.query(query)
+	if err != nil {
+		api.history.logger.Errorf("Can't read playback history: %s", err)
+		writeJSONError(w, http.StatusInternalServerError, "can't read the playback history")
+		return
+	}
+
+	page := &historyPage{Limit: limit, Offset: offset}
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case HistoryPath:
+		start, end := page.bounds(len(sessions))
+		page.Items = sessions[start:end]
+	case HistoryPath + "/days":
+		days := aggregateDays(sessions, api.location)
+		start, end := page.bounds(len(days))
+		page.Items = days[start:end]
+	case HistoryPath + "/titles":
+		titles := aggregateTitles(sessions)
+		start, end := page.bounds(len(titles))
+		page.Items = titles[start:end]
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// historyPage is a page of the results of the history API
+type historyPage struct {
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Items  interface{} `json:"items"`
+}
+
+// bounds returns the bounds of the page in the results
+func (p *historyPage) bounds(total int) (int, int) {
+	p.Total = total
+	start := p.Offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if p.Limit < total-start {
+		end = start + p.Limit
+	}
+	return start, end
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Can't write JSON response: %s", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Handler returns the HTTP API over the playback history
+func (h *PlaybackHistory) Handler() http.Handler {
+	return &historyAPI{history: h, location: time.Local}
+}
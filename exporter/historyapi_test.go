@@ -0,0 +1,113 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+func getHistoryPage(t *testing.T, api http.Handler, url string, items interface{}) *historyPage {
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Invalid status for %s: %d %s", url, w.Code, w.Body.String())
+	}
+	page := &historyPage{Items: items}
+	if err := json.Unmarshal(w.Body.Bytes(), page); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return page
+}
+
+func TestHistoryAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	history := newPlaybackHistory(newTestClient(t, "http://kodi:8080"), time.Minute, log.Base())
+	if err := history.open(filepath.Join(dir, "history.db")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer history.Close()
+
+	day := time.Date(2016, 7, 10, 20, 0, 0, 0, time.UTC)
+	for _, session := range []playbackSession{
+		{Target: "http://kodi:8080", Media: "movie", Title: "Heat", Start: day, End: day.Add(2 * time.Hour), Watched: 7200},
+		{Target: "http://kodi:8080", Media: "episode", Title: "Better Call Saul - Uno", Start: day.Add(24 * time.Hour), End: day.Add(25 * time.Hour), Watched: 3000},
+		{Target: "http://kodi:8080", Media: "episode", Title: "Better Call Saul - Uno", Start: day.Add(48 * time.Hour), End: day.Add(49 * time.Hour), Watched: 600},
+		{Target: "http://bedroom:8080", Media: "song", Title: "Dear Can", Start: day.Add(48 * time.Hour), End: day.Add(49 * time.Hour), Watched: 300},
+	} {
+		session := session
+		if err := history.save(&session); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	api := &historyAPI{history: history, location: time.UTC}
+
+	sessions := []playbackSession{}
+	page := getHistoryPage(t, api, "/api/v1/history?target=http://kodi:8080&limit=2", &sessions)
+	if page.Total != 3 || len(sessions) != 2 || sessions[0].Watched != 600 {
+		t.Fatalf("Invalid sessions: %v %v", page, sessions)
+	}
+	sessions = []playbackSession{}
+	page = getHistoryPage(t, api, "/api/v1/history?target=http://kodi:8080&limit=2&offset=2", &sessions)
+	if page.Total != 3 || len(sessions) != 1 || sessions[0].Title != "Heat" {
+		t.Fatalf("Invalid second page: %v %v", page, sessions)
+	}
+	sessions = []playbackSession{}
+	page = getHistoryPage(t, api, "/api/v1/history?limit=1000&offset=9223372036854775807", &sessions)
+	if page.Total != 4 || len(sessions) != 0 {
+		t.Fatalf("Invalid page after the last session: %v %v", page, sessions)
+	}
+	sessions = []playbackSession{}
+	getHistoryPage(t, api, "/api/v1/history?since=2016-07-11&media=episode", &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("Invalid filtered sessions: %v", sessions)
+	}
+
+	days := []historyDay{}
+	getHistoryPage(t, api, "/api/v1/history/days?since=2016-07-11T00:00:00Z", &days)
+	if len(days) != 2 || days[0].Day != "2016-07-11" || days[1].Sessions != 2 || days[1].Watched != 900 {
+		t.Fatalf("Invalid days: %v", days)
+	}
+
+	titles := []historyTitle{}
+	getHistoryPage(t, api, "/api/v1/history/titles?target=http://kodi:8080", &titles)
+	if len(titles) != 2 || titles[0].Title != "Heat" || titles[1].Sessions != 2 || titles[1].Watched != 3600 {
+		t.Fatalf("Invalid titles: %v", titles)
+	}
+
+	for url, status := range map[string]int{
+		"/api/v1/history?since=yesterday": http.StatusBadRequest,
+		"/api/v1/history?limit=-1":        http.StatusBadRequest,
+		"/api/v1/history/genres":          http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != status {
+			t.Fatalf("Invalid status for %s: %d", url, w.Code)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const boolParser = "bool"
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	valueTypes = map[string]prometheus.ValueType{
+		"":        prometheus.GaugeValue,
+		"gauge":   prometheus.GaugeValue,
+		"counter": prometheus.CounterValue,
+		"untyped": prometheus.UntypedValue,
+	}
+
+	valueParsers = map[string]infoLabelParser{
+		"":            kodi.ParseNumber,
+		"number":      kodi.ParseNumber,
+		boolParser:    kodi.ParseBool,
+		"percent":     kodi.ParsePercent,
+		"duration":    parseSeconds,
+		"bytes":       kodi.ParseBytes,
+		"temperature": kodi.ParseTemperature,
+	}
+)
+
+// infoMetric is a metric computed from InfoLabels and InfoBooleans.
+// It either holds a single parsed value, or is an info metric whose labels
+// are the raw values.
+type infoMetric struct {
+	desc        *prometheus.Desc
+	valueType   prometheus.ValueType
+	infoLabel   string
+	infoBoolean string
+	parser      infoLabelParser
+	labels      []InfoMetricConfig
+}
+
+// infoMetrics holds the metrics declared in the configuration file, and the
+// InfoLabels and InfoBooleans to retrieve for them.
+type infoMetrics struct {
+	metrics  []*infoMetric
+	labels   []string
+	booleans []string
+}
+
+func newInfoMetrics(configs []InfoMetricConfig) (*infoMetrics, error) {
+	m := &infoMetrics{}
+	byName := map[string]*infoMetric{}
+	seenLabels := map[string]bool{}
+	seenBooleans := map[string]bool{}
+	for _, config := range configs {
+		if err := config.validate(); err != nil {
+			return nil, err
+		}
+		if len(config.InfoLabel) > 0 && !seenLabels[config.InfoLabel] {
+			seenLabels[config.InfoLabel] = true
+			m.labels = append(m.labels, config.InfoLabel)
+		}
+		if len(config.InfoBoolean) > 0 && !seenBooleans[config.InfoBoolean] {
+			seenBooleans[config.InfoBoolean] = true
+			m.booleans = append(m.booleans, config.InfoBoolean)
+		}
+
+		metric, ok := byName[config.Name]
+		if len(config.Label) == 0 {
+			if ok {
+				return nil, fmt.Errorf("Metric %s is declared twice", config.Name)
+			}
+			metric = &infoMetric{
+				valueType:   valueTypes[config.Type],
+				infoLabel:   config.InfoLabel,
+				infoBoolean: config.InfoBoolean,
+				parser:      valueParsers[config.Parser],
+			}
+			byName[config.Name] = metric
+			m.metrics = append(m.metrics, metric)
+			continue
+		}
+		if !ok {
+			metric = &infoMetric{valueType: prometheus.GaugeValue}
+			byName[config.Name] = metric
+			m.metrics = append(m.metrics, metric)
+		} else if metric.labels == nil {
+			return nil, fmt.Errorf("Metric %s is declared twice", config.Name)
+		}
+		for _, label := range metric.labels {
+			if label.Label == config.Label {
+				return nil, fmt.Errorf("Metric %s: label %s is declared twice", config.Name, config.Label)
+			}
+		}
+		metric.labels = append(metric.labels, config)
+	}
+
+	for _, config := range configs {
+		metric := byName[config.Name]
+		if metric.desc != nil {
+			continue
+		}
+		help := config.Help
+		if len(help) == 0 {
+			help = fmt.Sprintf("Kodi %s%s.", config.InfoLabel, config.InfoBoolean)
+		}
+		var labelNames []string
+		for _, label := range metric.labels {
+			labelNames = append(labelNames, label.Label)
+		}
+		metric.desc = newLimitedDesc(config.Name, help, labelNames)
+	}
+	return m, nil
+}
+
+func (m *infoMetrics) describe(ch chan<- *prometheus.Desc) {
+	if m == nil {
+		return
+	}
+	for _, metric := range m.metrics {
+		ch <- metric.desc
+	}
+}
+
+func (m *infoMetrics) collect(ch chan<- prometheus.Metric, labels map[string]string, booleans map[string]bool, logger log.Logger) {
+	for _, metric := range m.metrics {
+		if metric.labels != nil {
+			values, ok := infoMetricLabelValues(metric.labels, labels, booleans)
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metric.desc, metric.valueType, 1, values...,
+			)
+			continue
+		}
+
+		var value float64
+		if len(metric.infoBoolean) > 0 {
+			b, ok := booleans[metric.infoBoolean]
+			if !ok {
+				logger.Debugf("InfoBoolean %s not available", metric.infoBoolean)
+				continue
+			}
+			if b {
+				value = 1
+			}
+		} else {
+			var err error
+			value, err = metric.parser(labels[metric.infoLabel])
+			if err != nil {
+				logger.Debugf("Can't parse %s: %s", metric.infoLabel, err)
+				continue
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metric.desc, metric.valueType, value,
+		)
+	}
+}
+
+func infoMetricLabelValues(configs []InfoMetricConfig, labels map[string]string, booleans map[string]bool) ([]string, bool) {
+	var values []string
+	for _, config := range configs {
+		if len(config.InfoBoolean) > 0 {
+			b, ok := booleans[config.InfoBoolean]
+			if !ok {
+				return nil, false
+			}
+			values = append(values, strconv.FormatBool(b))
+			continue
+		}
+		value := strings.TrimSpace(labels[config.InfoLabel])
+		if value == kodi.BusyInfoLabel {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+func (e *Exporter) collectInfoMetrics(ch chan<- prometheus.Metric) error {
+	if e.infoMetrics == nil || len(e.infoMetrics.metrics) == 0 {
+		return nil
+	}
+	labels := map[string]string{}
+	if len(e.infoMetrics.labels) > 0 {
+		resp, err := e.client.GetInfoLabels(e.infoMetrics.labels)
+		if err != nil || resp.Error != nil {
+			e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+			return rpcError(err, resp.Error)
+		}
+		labels = resp.Result
+	}
+	booleans := map[string]bool{}
+	if len(e.infoMetrics.booleans) > 0 {
+		resp, err := e.client.GetInfoBooleans(e.infoMetrics.booleans)
+		if err != nil || resp.Error != nil {
+			e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+			return rpcError(err, resp.Error)
+		}
+		booleans = resp.Result
+	}
+	e.infoMetrics.collect(ch, labels, booleans, e.logger)
+	return nil
+}
+
+func init() {
+	registerCollector("info", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectInfoMetrics)
+	}, "Export the custom metrics from InfoLabels and InfoBooleans.")
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+const infoMetricsConfig = `
+info_metrics:
+  - infolabel: System.ScreenResolution
+    name: kodi_screen_info
+    label: resolution
+  - infolabel: Skin.CurrentTheme
+    name: kodi_screen_info
+    label: theme
+  - infolabel: System.Memory(free)
+    name: kodi_memory_free_bytes
+    help: Free memory.
+    parser: bytes
+  - infoboolean: System.ScreenSaverActive
+    name: kodi_screensaver_active
+`
+
+func writeConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return f.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	filename := writeConfig(t, infoMetricsConfig)
+	defer os.Remove(filename)
+
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(config.InfoMetrics) != 4 {
+		t.Fatalf("Invalid info metrics: %v", config.InfoMetrics)
+	}
+}
+
+func TestLoadInvalidConfig(t *testing.T) {
+	for _, content := range []string{
+		"info_metrics:\n  - infolabel: System.FPS\n    name: kodi-fps\n",
+		"info_metrics:\n  - name: kodi_fps\n",
+		"info_metrics:\n  - infolabel: System.FPS\n    name: kodi_fps\n    parser: foo\n",
+		"info_metrics:\n  - infoboolean: System.HasPVRAddon\n    name: kodi_pvr\n    parser: bytes\n",
+	} {
+		filename := writeConfig(t, content)
+		defer os.Remove(filename)
+		if _, err := LoadConfig(filename); err == nil {
+			t.Fatalf("Invalid configuration accepted: %s", content)
+		}
+	}
+}
+
+func TestInfoMetricsDeclaredTwice(t *testing.T) {
+	_, err := newInfoMetrics([]InfoMetricConfig{
+		{InfoLabel: "System.FPS", Name: "kodi_fps"},
+		{InfoLabel: "System.FPS", Name: "kodi_fps", Label: "fps"},
+	})
+	if err == nil {
+		t.Fatalf("Duplicated metric accepted")
+	}
+}
+
+func TestInfoMetricsCollect(t *testing.T) {
+	filename := writeConfig(t, infoMetricsConfig)
+	defer os.Remove(filename)
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	m, err := newInfoMetrics(config.InfoMetrics)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(m.labels) != 3 || len(m.booleans) != 1 {
+		t.Fatalf("Invalid InfoLabels to retrieve: %v %v", m.labels, m.booleans)
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	m.collect(ch,
+		map[string]string{
+			"System.ScreenResolution": "1920x1080@60.00Hz - Full Screen",
+			"Skin.CurrentTheme":       "SKINDEFAULT",
+			"System.Memory(free)":     "1.5 GB",
+		},
+		map[string]bool{"System.ScreenSaverActive": true},
+		log.Base())
+	close(ch)
+
+	values := map[string]float64{}
+	for metric := range ch {
+		pb := &dto.Metric{}
+		if err := metric.Write(pb); err != nil {
+			t.Fatalf("%v", err)
+		}
+		var value float64
+		if pb.Gauge != nil {
+			value = pb.Gauge.GetValue()
+		}
+		values[metric.Desc().String()] = value
+		if len(pb.Label) == 2 && pb.Label[1].GetValue() != "SKINDEFAULT" {
+			t.Fatalf("Invalid info metric labels: %v", pb.Label)
+		}
+	}
+	if len(values) != 3 {
+		t.Fatalf("Invalid metrics: %v", values)
+	}
+	for desc, value := range values {
+		if value != 1 && value != 1.5*(1<<30) {
+			t.Fatalf("Invalid value for %s: %f", desc, value)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a subset of JSONPath used to select values in a JSONRPC
+// result: `$.addons[*].addonid`, `$.limits.total`, `$['System.FPS']`.
+type jsonPath struct {
+	expression string
+	steps      []jsonPathStep
+}
+
+// jsonPathStep is either a member name, an array index, or a wildcard
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parseJSONPath(expression string) (*jsonPath, error) {
+	path := &jsonPath{expression: expression}
+	s := strings.TrimSpace(expression)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("Invalid path %q: must start with $", expression)
+	}
+	s = s[1:]
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			if len(name) == 0 {
+				return nil, fmt.Errorf("Invalid path %q: empty member name", expression)
+			}
+			if name == "*" {
+				path.steps = append(path.steps, jsonPathStep{wildcard: true})
+			} else {
+				path.steps = append(path.steps, jsonPathStep{name: name})
+			}
+			s = s[end:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path %q: missing ]", expression)
+			}
+			selector := s[1:end]
+			s = s[end+1:]
+			switch {
+			case selector == "*":
+				path.steps = append(path.steps, jsonPathStep{wildcard: true})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				path.steps = append(path.steps, jsonPathStep{name: selector[1 : len(selector)-1]})
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid path %q: invalid index %s", expression, selector)
+				}
+				path.steps = append(path.steps, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("Invalid path %q: unexpected %q", expression, s[0])
+		}
+	}
+	return path, nil
+}
+
+// Select returns all the values matching the path. Missing members are
+// ignored.
+func (p *jsonPath) Select(value interface{}) []interface{} {
+	values := []interface{}{value}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, step.apply(v)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func (s jsonPathStep) apply(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			var values []interface{}
+			for _, item := range v {
+				values = append(values, item)
+			}
+			return values
+		}
+		if item, ok := v[s.name]; ok && !s.isIndex {
+			return []interface{}{item}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return v
+		}
+		if s.isIndex {
+			index := s.index
+			if index < 0 {
+				index += len(v)
+			}
+			if index >= 0 && index < len(v) {
+				return []interface{}{v[index]}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *jsonPath) String() string {
+	return p.expression
+}
@@ -0,0 +1,232 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	// instanceLabel is the name of the Kodi device
+	instanceLabel     = "kodi_instance"
+	friendlyNameLabel = "System.FriendlyName"
+	// unresolvedInstance is the kodi_instance label of the described
+	// metrics until the name of the Kodi device is resolved
+	unresolvedInstance = "unresolved"
+)
+
+// reservedLabels are the label names of the metrics of the exporter, which
+// can't be used by the const labels
+var reservedLabels = map[string]bool{}
+
+// labelNames returns the label names of a metric, and reserves them
+func labelNames(names ...string) []string {
+	for _, name := range names {
+		reservedLabels[name] = true
+	}
+	return names
+}
+
+// ParseLabels parses a list of labels: name=value,name=value
+func ParseLabels(s string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	if len(strings.TrimSpace(s)) == 0 {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid label %q: name=value expected", pair)
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	if err := validateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func validateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRegexp.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("Invalid label name: %q", name)
+		}
+		if name == instanceLabel {
+			return fmt.Errorf("Label %s is reserved", instanceLabel)
+		}
+		if reservedLabels[name] {
+			return fmt.Errorf("Label %s is used by the Kodi metrics", name)
+		}
+	}
+	return nil
+}
+
+// validateCustomLabels checks the const labels don't clash with the labels
+// of the custom metrics
+func validateCustomLabels(labels prometheus.Labels, m *infoMetrics, calls []*rpcMetrics) error {
+	names := []string{}
+	for _, metric := range m.metrics {
+		for _, label := range metric.labels {
+			names = append(names, label.Label)
+		}
+	}
+	for _, call := range calls {
+		for _, metric := range call.metrics {
+			names = append(names, metric.labelNames...)
+		}
+	}
+	for _, name := range names {
+		if _, ok := labels[name]; ok {
+			return fmt.Errorf("Label %s is used by the custom metrics", name)
+		}
+	}
+	return nil
+}
+
+// mergeLabels returns the labels of the maps, the last ones overriding the
+// first ones
+func mergeLabels(maps ...map[string]string) prometheus.Labels {
+	labels := prometheus.Labels{}
+	for _, m := range maps {
+		for name, value := range m {
+			labels[name] = value
+		}
+	}
+	return labels
+}
+
+// labels returns the labels added to the metrics: the const labels, and the
+// kodi_instance label. It returns false while this label isn't resolved.
+func (e *Exporter) labels() (prometheus.Labels, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.instanceLabel {
+		return e.constLabels, true
+	}
+	if len(e.instance) == 0 {
+		return e.constLabels, false
+	}
+	return mergeLabels(e.constLabels, map[string]string{instanceLabel: e.instance}), true
+}
+
+// resolveInstance resolves the kodi_instance label using the name of the
+// Kodi device. It returns false if the name is not available yet.
+func (e *Exporter) resolveInstance() bool {
+	if _, resolved := e.labels(); resolved {
+		return true
+	}
+	resp, err := e.client.GetInfoLabels([]string{friendlyNameLabel})
+	if err != nil || resp.Error != nil {
+		e.logger.Debugf("Kodi instance not resolved: %v %v", err, resp.Error)
+		return false
+	}
+	instance := strings.TrimSpace(resp.Result[friendlyNameLabel])
+	if len(instance) == 0 || instance == kodi.BusyInfoLabel {
+		return false
+	}
+	e.mu.Lock()
+	e.instance = instance
+	e.mu.Unlock()
+	e.logger.Infof("Kodi instance: %s", instance)
+	return true
+}
+
+// labelledCollector adds the labels of an exporter to the metrics of a
+// collector. Until the kodi_instance label is resolved, the metrics are
+// described using a placeholder instance, so the registries still check them.
+type labelledCollector struct {
+	e         *Exporter
+	collector prometheus.Collector
+	mu        sync.Mutex
+	resolved  bool
+	wrapped   prometheus.Collector
+	described prometheus.Collector
+}
+
+// Labelled returns a collector adding the labels of the exporter to the
+// metrics of c: the const labels, and the kodi_instance label once resolved
+func (e *Exporter) Labelled(c prometheus.Collector) prometheus.Collector {
+	return &labelledCollector{e: e, collector: c}
+}
+
+// current returns the collector wrapped with the current labels
+func (c *labelledCollector) current() (prometheus.Collector, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wrapped == nil || !c.resolved {
+		labels, resolved := c.e.labels()
+		c.wrapped, c.resolved = wrapCollector(labels, c.collector), resolved
+	}
+	return c.wrapped, c.resolved
+}
+
+func (c *labelledCollector) Describe(ch chan<- *prometheus.Desc) {
+	wrapped, resolved := c.current()
+	if resolved {
+		wrapped.Describe(ch)
+		return
+	}
+	c.mu.Lock()
+	if c.described == nil {
+		labels, _ := c.e.labels()
+		labels = mergeLabels(labels, map[string]string{instanceLabel: unresolvedInstance})
+		c.described = wrapCollector(labels, c.collector)
+	}
+	described := c.described
+	c.mu.Unlock()
+	described.Describe(ch)
+}
+
+func (c *labelledCollector) Collect(ch chan<- prometheus.Metric) {
+	wrapped, _ := c.current()
+	wrapped.Collect(ch)
+}
+
+// collectorCapture is a Registerer keeping the collector registered
+type collectorCapture struct {
+	collector prometheus.Collector
+}
+
+func (r *collectorCapture) Register(c prometheus.Collector) error {
+	r.collector = c
+	return nil
+}
+
+func (r *collectorCapture) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		r.Register(c)
+	}
+}
+
+func (r *collectorCapture) Unregister(c prometheus.Collector) bool {
+	return false
+}
+
+// wrapCollector returns a collector adding the const labels to the metrics
+// of c
+func wrapCollector(labels prometheus.Labels, c prometheus.Collector) prometheus.Collector {
+	if len(labels) == 0 {
+		return c
+	}
+	capture := &collectorCapture{}
+	prometheus.WrapRegistererWith(labels, capture).MustRegister(c)
+	return capture.collector
+}
@@ -0,0 +1,196 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels("room=living, device=shield")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !reflect.DeepEqual(labels, prometheus.Labels{"room": "living", "device": "shield"}) {
+		t.Fatalf("Invalid labels: %v", labels)
+	}
+	if labels, err := ParseLabels(""); err != nil || len(labels) != 0 {
+		t.Fatalf("Invalid empty labels: %v %v", labels, err)
+	}
+	for _, s := range []string{"room", "1room=living", "__room=living", "kodi_instance=shield"} {
+		if _, err := ParseLabels(s); err == nil {
+			t.Fatalf("Invalid labels accepted: %s", s)
+		}
+	}
+}
+
+func TestLabelClashes(t *testing.T) {
+	for _, s := range []string{"media=tv", "source=nas", "type=video", "collector=x", "profile=kids", "job=scan", "channel=1", "state=on"} {
+		if _, err := ParseLabels(s); err == nil {
+			t.Fatalf("Label clashing with the Kodi metrics accepted: %s", s)
+		}
+	}
+	if _, err := New(Options{
+		Client: newTestClient(t, "http://localhost"),
+		Config: &Config{Labels: map[string]string{"media": "tv"}},
+	}); err == nil {
+		t.Fatalf("Configuration label clashing with the Kodi metrics accepted")
+	}
+
+	for _, config := range []*Config{
+		{InfoMetrics: []InfoMetricConfig{{InfoLabel: "System.ScreenMode", Name: "kodi_screen_mode_info", Label: "mode"}}},
+		{RPCMetrics: []RPCMetricsConfig{{
+			Method:  "Player.GetActivePlayers",
+			Metrics: []RPCMetricConfig{{Name: "kodi_player_active", Each: "$.result[*]", Labels: map[string]string{"mode": "$.type"}}},
+		}}},
+	} {
+		if _, err := New(Options{
+			Client:      newTestClient(t, "http://localhost"),
+			ConstLabels: prometheus.Labels{"room": "living"},
+			Config:      config,
+		}); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := New(Options{
+			Client:      newTestClient(t, "http://localhost"),
+			ConstLabels: prometheus.Labels{"mode": "tv"},
+			Config:      config,
+		}); err == nil {
+			t.Fatalf("Label clashing with the custom metrics accepted: %+v", config)
+		}
+		config.Labels = map[string]string{"mode": "tv"}
+		if _, err := New(Options{Client: newTestClient(t, "http://localhost"), Config: config}); err == nil {
+			t.Fatalf("Configuration label clashing with the custom metrics accepted: %+v", config)
+		}
+	}
+}
+
+func metricLabels(t *testing.T, metric prometheus.Metric) map[string]string {
+	pb := &dto.Metric{}
+	if err := metric.Write(pb); err != nil {
+		t.Fatalf("%v", err)
+	}
+	labels := map[string]string{}
+	for _, pair := range pb.Label {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+func TestInstanceLabel(t *testing.T) {
+	h, _ := newKodiRPCServer(t, map[string]string{
+		"JSONRPC.Ping":       `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+		"XBMC.GetInfoLabels": `{"id":1,"jsonrpc":"2.0","result":{"System.FriendlyName":"Shield"}}`,
+	})
+	defer h.Close()
+	e, err := New(Options{
+		Client:        newTestClient(t, h.URL),
+		Collectors:    map[string]bool{"audio": false, "video": false, "genres": false},
+		ConstLabels:   prometheus.Labels{"room": "living", "device": "shield"},
+		InstanceLabel: true,
+		Config:        &Config{Labels: map[string]string{"room": "bedroom"}},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	descs := make(chan *prometheus.Desc, 100)
+	e.Describe(descs)
+	close(descs)
+	if len(descs) == 0 {
+		t.Fatalf("Exporter should be checked")
+	}
+	for desc := range descs {
+		if !strings.Contains(desc.String(), `kodi_instance="unresolved"`) {
+			t.Fatalf("Invalid placeholder instance of %s", desc)
+		}
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+	if err := registry.Register(e.Labelled(prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "kodi_test"}, []string{"room"}))); err == nil {
+		t.Fatalf("Collector clashing with the const labels registered")
+	}
+	e.connect(time.Millisecond, false)
+
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		e.Collect(ch)
+	})
+	if len(metrics) == 0 {
+		t.Fatalf("No metrics")
+	}
+	expected := map[string]string{"room": "bedroom", "device": "shield", "kodi_instance": "Shield"}
+	for _, metric := range metrics {
+		labels := metricLabels(t, metric)
+		for name, value := range expected {
+			if labels[name] != value {
+				t.Fatalf("Invalid labels of %s: %v", metric.Desc(), labels)
+			}
+		}
+	}
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "kodi_maintenance_test"})
+	metrics = gather(e.Labelled(gauge).Collect)
+	if labels := metricLabels(t, metrics[0]); !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("Invalid labels of the labelled collector: %v", labels)
+	}
+
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestStaticInstanceLabel(t *testing.T) {
+	h, _ := newKodiRPCServer(t, map[string]string{
+		"JSONRPC.Ping": `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+	})
+	defer h.Close()
+	for _, config := range []*Config{nil, {Instance: "bedroom"}} {
+		e, err := New(Options{
+			Client:     newTestClient(t, h.URL),
+			Collectors: map[string]bool{"audio": false, "video": false, "genres": false},
+			Instance:   "living",
+			Config:     config,
+		})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		expected := "living"
+		if config != nil {
+			expected = "bedroom"
+		}
+
+		descs := make(chan *prometheus.Desc, 100)
+		e.Describe(descs)
+		close(descs)
+		if len(descs) == 0 {
+			t.Fatalf("Exporter should be checked")
+		}
+		metrics := gather(e.Collect)
+		if len(metrics) == 0 {
+			t.Fatalf("No metrics")
+		}
+		for _, metric := range metrics {
+			if labels := metricLabels(t, metric); labels[instanceLabel] != expected {
+				t.Fatalf("Invalid labels of %s: %v", metric.Desc(), labels)
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+// libraryChangesLabels are the labels of the library changes counters
+var libraryChangesLabels = labelNames("media")
+
+// librarySnapshots are the items of the libraries, by target and media,
+// identified by their Kodi IDs
+type librarySnapshots map[string]map[string]map[int]string
+
+// libraryChanges detects the items added to and removed from the libraries,
+// by comparing the items with the previous snapshot.
+type libraryChanges struct {
+	mu        sync.Mutex
+	target    string
+	filename  string
+	logTitles bool
+	snapshots librarySnapshots
+	added     *prometheus.CounterVec
+	removed   *prometheus.CounterVec
+	logger    log.Logger
+}
+
+func newLibraryChanges(target string, logger log.Logger) *libraryChanges {
+	return &libraryChanges{
+		target:    target,
+		logger:    logger,
+		snapshots: librarySnapshots{},
+		added: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "library",
+			Name:      "items_added_total",
+			Help:      "How many items were added to the library.",
+		}, libraryChangesLabels),
+		removed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "library",
+			Name:      "items_removed_total",
+			Help:      "How many items were removed from the library.",
+		}, libraryChangesLabels),
+	}
+}
+
+// load reads the snapshots saved in the state file
+func (c *libraryChanges) load(filename string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filename = filename
+	if len(filename) == 0 {
+		return nil
+	}
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Can't read library state file: %s", err)
+	}
+	snapshots := librarySnapshots{}
+	if err := json.Unmarshal(content, &snapshots); err != nil {
+		return fmt.Errorf("Can't decode library state file %s: %s", filename, err)
+	}
+	c.snapshots = snapshots
+	return nil
+}
+
+// save writes the snapshots in the state file
+func (c *libraryChanges) save() error {
+	if len(c.filename) == 0 {
+		return nil
+	}
+	content, err := json.Marshal(c.snapshots)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(c.filename, content)
+}
+
+// writeStateFile replaces a state file atomically, so a crash can't corrupt
+// it
+func writeStateFile(filename string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// update compares the items of a library with the previous snapshot
+func (c *libraryChanges) update(media string, items map[int]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Initialize the series, to be able to compute rates
+	added := c.added.WithLabelValues(media)
+	removed := c.removed.WithLabelValues(media)
+
+	snapshots, ok := c.snapshots[c.target]
+	if !ok {
+		snapshots = map[string]map[int]string{}
+		c.snapshots[c.target] = snapshots
+	}
+	previous, ok := snapshots[media]
+	snapshots[media] = items
+	if !ok {
+		// First snapshot
+		if err := c.save(); err != nil {
+			c.logger.Errorf("Can't save library state: %s", err)
+		}
+		return
+	}
+
+	changed := false
+	for id, title := range items {
+		if _, ok := previous[id]; !ok {
+			added.Inc()
+			changed = true
+			if c.logTitles {
+				c.logger.Infof("Library %s added: %s", media, title)
+			}
+		}
+	}
+	for id, title := range previous {
+		if _, ok := items[id]; !ok {
+			removed.Inc()
+			changed = true
+			if c.logTitles {
+				c.logger.Infof("Library %s removed: %s", media, title)
+			}
+		}
+	}
+	if changed {
+		if err := c.save(); err != nil {
+			c.logger.Errorf("Can't save library state: %s", err)
+		}
+	}
+}
+
+// complete returns true if a list holds all the items of the library. A
+// partial list would be seen as removed items.
+func complete(limits *kodi.ListLimitsReturned, size int) bool {
+	return limits == nil || limits.Total == size
+}
+
+func (c *libraryChanges) describe(ch chan<- *prometheus.Desc) {
+	c.added.Describe(ch)
+	c.removed.Describe(ch)
+}
+
+func (c *libraryChanges) collect(ch chan<- prometheus.Metric) {
+	c.added.Collect(ch)
+	c.removed.Collect(ch)
+}
+
+// collectLibraryChanges compares the items of the libraries with the
+// previous snapshots, and exports the counts of the added and removed items
+func (e *Exporter) collectLibraryChanges(ch chan<- prometheus.Metric) error {
+	var lastErr error
+	for _, diff := range []func() error{
+		e.collectAlbumsChanges,
+		e.collectSongsChanges,
+		e.collectMoviesChanges,
+		e.collectEpisodesChanges,
+	} {
+		if err := diff(); err != nil {
+			lastErr = err
+		}
+	}
+	e.libraryChanges.collect(ch)
+	return lastErr
+}
+
+func (e *Exporter) collectAlbumsChanges() error {
+	albumsResp, err := e.client.AudioGetAlbums()
+	if err != nil || albumsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, albumsResp.Error)
+		return rpcError(err, albumsResp.Error)
+	}
+	if !complete(albumsResp.Result.Limits, len(albumsResp.Result.Albums)) {
+		return nil
+	}
+	items := map[int]string{}
+	for _, album := range albumsResp.Result.Albums {
+		items[album.AlbumID] = album.Label
+	}
+	e.libraryChanges.update("album", items)
+	return nil
+}
+
+func (e *Exporter) collectSongsChanges() error {
+	songsResp, err := e.client.AudioGetSongs()
+	if err != nil || songsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, songsResp.Error)
+		return rpcError(err, songsResp.Error)
+	}
+	if !complete(songsResp.Result.Limits, len(songsResp.Result.Songs)) {
+		return nil
+	}
+	items := map[int]string{}
+	for _, song := range songsResp.Result.Songs {
+		items[song.SongID] = song.Label
+	}
+	e.libraryChanges.update("song", items)
+	return nil
+}
+
+func (e *Exporter) collectMoviesChanges() error {
+	moviesResp, err := e.client.VideoGetMovies()
+	if err != nil || moviesResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, moviesResp.Error)
+		return rpcError(err, moviesResp.Error)
+	}
+	if !complete(moviesResp.Result.Limits, len(moviesResp.Result.Movies)) {
+		return nil
+	}
+	items := map[int]string{}
+	for _, movie := range moviesResp.Result.Movies {
+		items[movie.MovieID] = movie.Label
+	}
+	e.libraryChanges.update("movie", items)
+	return nil
+}
+
+func (e *Exporter) collectEpisodesChanges() error {
+	episodesResp, err := e.client.VideoGetEpisodes()
+	if err != nil || episodesResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, episodesResp.Error)
+		return rpcError(err, episodesResp.Error)
+	}
+	if !complete(episodesResp.Result.Limits, len(episodesResp.Result.Episodes)) {
+		return nil
+	}
+	items := map[int]string{}
+	for _, episode := range episodesResp.Result.Episodes {
+		items[episode.EpisodeID] = episode.Label
+	}
+	e.libraryChanges.update("episode", items)
+	return nil
+}
+
+// LoadLibraryState reads the library snapshots from a state file, and saves
+// them in this file when they change
+func (e *Exporter) LoadLibraryState(filename string, logTitles bool) error {
+	e.libraryChanges.logTitles = logTitles
+	return e.libraryChanges.load(filename)
+}
+
+func init() {
+	registerCollector("library_changes", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectLibraryChanges)
+	}, "Count the items added to and removed from the libraries.")
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+func counterValue(t *testing.T, c interface {
+	Write(*dto.Metric) error
+}) float64 {
+	pb := &dto.Metric{}
+	if err := c.Write(pb); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return pb.Counter.GetValue()
+}
+
+func TestLibraryChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "library.json")
+
+	changes := newLibraryChanges("http://kodi:8080", log.Base())
+	if err := changes.load(filename); err != nil {
+		t.Fatalf("%v", err)
+	}
+	changes.update("movie", map[int]string{1: "Heat", 2: "Aladdin", 3: "Alien"})
+	changes.update("movie", map[int]string{1: "Heat", 3: "Alien", 4: "Aliens", 5: "Ran"})
+	if added := counterValue(t, changes.added.WithLabelValues("movie")); added != 2 {
+		t.Fatalf("Invalid added movies: %f", added)
+	}
+	if removed := counterValue(t, changes.removed.WithLabelValues("movie")); removed != 1 {
+		t.Fatalf("Invalid removed movies: %f", removed)
+	}
+
+	// Changes while the exporter was stopped are detected
+	restarted := newLibraryChanges("http://kodi:8080", log.Base())
+	if err := restarted.load(filename); err != nil {
+		t.Fatalf("%v", err)
+	}
+	restarted.update("movie", map[int]string{1: "Heat", 3: "Alien", 4: "Aliens"})
+	if removed := counterValue(t, restarted.removed.WithLabelValues("movie")); removed != 1 {
+		t.Fatalf("Invalid removed movies after restart: %f", removed)
+	}
+
+	// Another target has its own snapshots
+	other := newLibraryChanges("http://bedroom:8080", log.Base())
+	if err := other.load(filename); err != nil {
+		t.Fatalf("%v", err)
+	}
+	other.update("movie", map[int]string{1: "Heat"})
+	if removed := counterValue(t, other.removed.WithLabelValues("movie")); removed != 0 {
+		t.Fatalf("Invalid removed movies for another target: %f", removed)
+	}
+}
+
+func TestLibraryChangesCollector(t *testing.T) {
+	recorder := &kodiRecorder{responses: map[string]string{
+		"AudioLibrary.GetAlbums":   `{"id":1,"jsonrpc":"2.0","result":{"albums":[{"albumid":1,"label":"Kind of Blue"}],"limits":{"end":1,"start":0,"total":1}}}`,
+		"AudioLibrary.GetSongs":    `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":0,"start":0,"total":0},"songs":[]}}`,
+		"VideoLibrary.GetMovies":   `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":1,"start":0,"total":1},"movies":[{"label":"Heat","movieid":1}]}}`,
+		"VideoLibrary.GetEpisodes": `{"id":1,"jsonrpc":"2.0","result":{"episodes":[],"limits":{"end":0,"start":0,"total":0}}}`,
+		"VideoLibrary.GetTVShows":  `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":0,"start":0,"total":0},"tvshows":[]}}`,
+	}, strict: true}
+	h := httptest.NewServer(recorder)
+	defer h.Close()
+	e := &Exporter{
+		client:         newTestClient(t, h.URL),
+		logger:         log.Base(),
+		libraryChanges: newLibraryChanges(h.URL, log.Base()),
+	}
+
+	if err := e.collectLibraryChanges(make(chan prometheus.Metric, 100)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	recorder.respond("VideoLibrary.GetMovies", `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":2,"start":0,"total":2},"movies":[{"label":"Heat","movieid":1},{"label":"Ran","movieid":2}]}}`)
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		if err := e.collectLibraryChanges(ch); err != nil {
+			t.Fatalf("%v", err)
+		}
+	})
+	if len(metrics) == 0 {
+		t.Fatalf("The changes should be exported")
+	}
+	if added := counterValue(t, e.libraryChanges.added.WithLabelValues("movie")); added != 1 {
+		t.Fatalf("Invalid added movies: %f", added)
+	}
+	if added := counterValue(t, e.libraryChanges.added.WithLabelValues("album")); added != 0 {
+		t.Fatalf("Invalid added albums: %f", added)
+	}
+
+	// The library collectors don't query the items to compare them
+	episodes := recorder.called("VideoLibrary.GetEpisodes")
+	gather(func(ch chan<- prometheus.Metric) {
+		e.collectVideoMetrics(ch)
+	})
+	if calls := recorder.called("VideoLibrary.GetEpisodes"); calls != episodes {
+		t.Fatalf("The video collector should not query the episodes: %d", calls)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"time"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+var (
+	// eventDrivenCollectors are refreshed when the libraries change
+	eventDrivenCollectors = map[string]bool{
+		"audio":           true,
+		"video":           true,
+		"genres":          true,
+		"library_changes": true,
+		"library_sources": true,
+	}
+
+	// libraryEvents are the notifications sent by Kodi when the libraries
+	// change
+	libraryEvents = []string{
+		"VideoLibrary.OnUpdate",
+		"VideoLibrary.OnRemove",
+		"VideoLibrary.OnScanFinished",
+		"VideoLibrary.OnCleanFinished",
+		"AudioLibrary.OnUpdate",
+		"AudioLibrary.OnRemove",
+		"AudioLibrary.OnScanFinished",
+		"AudioLibrary.OnCleanFinished",
+	}
+)
+
+// refreshInterval returns the minimum refresh interval of a sub-collector.
+// While the notifications are received, the library collectors are only
+// refreshed when the libraries change, and every ResyncInterval.
+func (e *Exporter) refreshInterval(name string) time.Duration {
+	if e.events != nil && eventDrivenCollectors[name] && e.events.Connected() {
+		return e.resyncInterval
+	}
+	return e.refreshIntervals[name]
+}
+
+// invalidate forces the refresh of some sub-collectors
+func (e *Exporter) invalidate(names map[string]bool) {
+	e.snapshots.mu.Lock()
+	defer e.snapshots.mu.Unlock()
+	for name := range names {
+		e.snapshots.generations[name]++
+	}
+}
+
+func (e *Exporter) subscribeLibraryEvents(listener *kodi.NotificationsListener) {
+	e.events = listener
+	// The changes notified while the listener was disconnected are lost
+	listener.OnConnect(func() {
+		e.logger.Debugf("Kodi notifications connected, refreshing the libraries")
+		e.invalidate(eventDrivenCollectors)
+	})
+	for _, method := range libraryEvents {
+		listener.Subscribe(method, func(n *kodi.Notification) {
+			e.logger.Debugf("Library changed: %s", n.Method)
+			e.invalidate(eventDrivenCollectors)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+func TestLibraryEvents(t *testing.T) {
+	recorder := &kodiRecorder{responses: map[string]string{
+		"JSONRPC.Ping":          `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+		"AudioLibrary.GetSongs": `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":0,"start":0,"total":0},"songs":[]}}`,
+	}}
+	h := httptest.NewServer(recorder)
+	defer h.Close()
+	e, err := New(Options{
+		Client:     newTestClient(t, h.URL),
+		Collectors: map[string]bool{"library_changes": false},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	e.resyncInterval = time.Hour
+
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer server.Close()
+	conns := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	listener := kodi.NewNotificationsListener(server.Addr().String())
+	listener.RetryDelay = 10 * time.Millisecond
+	e.SubscribeNotifications(listener)
+	listener.Start()
+	defer listener.Stop()
+	conn := <-conns
+	defer conn.Close()
+	for !listener.Connected() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	scrape := func() {
+		gather(func(ch chan<- prometheus.Metric) {
+			e.Collect(ch)
+		})
+	}
+	scrape()
+	scrape()
+	if songs := recorder.called("AudioLibrary.GetSongs"); songs != 1 {
+		t.Fatalf("Library should be refreshed on changes only: %d", songs)
+	}
+
+	generation := func() uint64 {
+		e.snapshots.mu.Lock()
+		defer e.snapshots.mu.Unlock()
+		return e.snapshots.generations["audio"]
+	}
+	waitInvalidated := func(previous uint64) {
+		for i := 0; i < 100 && generation() == previous; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	previous := generation()
+	conn.Write([]byte(`{"jsonrpc":"2.0","method":"AudioLibrary.OnUpdate","params":{"data":{"item":{"id":1,"type":"song"}},"sender":"xbmc"}}`))
+	waitInvalidated(previous)
+	scrape()
+	if songs := recorder.called("AudioLibrary.GetSongs"); songs != 2 {
+		t.Fatalf("Library should be refreshed after a change: %d", songs)
+	}
+
+	// The changes notified while reconnecting are lost: the library is
+	// refreshed once reconnected
+	previous = generation()
+	conn.Close()
+	conn = <-conns
+	defer conn.Close()
+	waitInvalidated(previous)
+	for !listener.Connected() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	scrape()
+	scrape()
+	if songs := recorder.called("AudioLibrary.GetSongs"); songs != 3 {
+		t.Fatalf("Library should be refreshed once reconnected: %d", songs)
+	}
+
+	// Without notifications, the library is refreshed on each scrape
+	listener.Stop()
+	for listener.Connected() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	scrape()
+	if songs := recorder.called("AudioLibrary.GetSongs"); songs != 4 {
+		t.Fatalf("Library should be refreshed without notifications: %d", songs)
+	}
+}
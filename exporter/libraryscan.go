@@ -0,0 +1,188 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	scanningBoolean      = "Library.IsScanning"
+	videoScanningBoolean = "Library.IsScanningVideo"
+	musicScanningBoolean = "Library.IsScanningMusic"
+)
+
+var (
+	libraryScanning = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "library", "scanning"),
+		"Is the library being scanned.",
+		labelNames("media"), nil,
+	)
+	libraryLastScanFinished = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "library", "last_scan_finished_timestamp_seconds"),
+		"When the last scan of the library finished.",
+		labelNames("media"), nil,
+	)
+	libraryLastCleanFinished = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "library", "last_clean_finished_timestamp_seconds"),
+		"When the last clean of the library finished.",
+		labelNames("media"), nil,
+	)
+	libraryScanDurationLabels = labelNames("media")
+
+	// Notifications sent by Kodi for the library scans, by media
+	libraryNotifications = map[string]string{
+		"VideoLibrary": "video",
+		"AudioLibrary": "music",
+	}
+)
+
+// libraryScans tracks the scans of the libraries, from the state polled
+// using InfoBooleans and from the Kodi notifications.
+type libraryScans struct {
+	mu            sync.Mutex
+	started       map[string]time.Time
+	scanFinished  map[string]time.Time
+	cleanFinished map[string]time.Time
+	duration      *prometheus.HistogramVec
+	logger        log.Logger
+}
+
+func newLibraryScans(logger log.Logger) *libraryScans {
+	return &libraryScans{
+		logger:        logger,
+		started:       map[string]time.Time{},
+		scanFinished:  map[string]time.Time{},
+		cleanFinished: map[string]time.Time{},
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "library",
+			Name:      "scan_duration_seconds",
+			Help:      "Duration of the library scans.",
+			Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		}, libraryScanDurationLabels),
+	}
+}
+
+// update records the state of a library scan. Only the state transitions
+// are taken into account, so both the polled state and the notifications
+// can be used.
+func (s *libraryScans) update(media string, scanning bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	started, ok := s.started[media]
+	switch {
+	case scanning && !ok:
+		s.logger.Infof("Library scan started: %s", media)
+		s.started[media] = now
+	case !scanning && ok:
+		delete(s.started, media)
+		s.scanFinished[media] = now
+		s.duration.WithLabelValues(media).Observe(now.Sub(started).Seconds())
+		s.logger.Infof("Library scan finished: %s in %s", media, now.Sub(started))
+	}
+}
+
+func (s *libraryScans) cleaned(media string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanFinished[media] = now
+}
+
+func (s *libraryScans) subscribe(listener *kodi.NotificationsListener) {
+	for prefix, media := range libraryNotifications {
+		media := media
+		listener.Subscribe(prefix+".OnScanStarted", func(*kodi.Notification) {
+			s.update(media, true, time.Now())
+		})
+		listener.Subscribe(prefix+".OnScanFinished", func(*kodi.Notification) {
+			s.update(media, false, time.Now())
+		})
+		listener.Subscribe(prefix+".OnCleanFinished", func(*kodi.Notification) {
+			s.cleaned(media, time.Now())
+		})
+	}
+}
+
+func (s *libraryScans) describe(ch chan<- *prometheus.Desc) {
+	ch <- libraryScanning
+	ch <- libraryLastScanFinished
+	ch <- libraryLastCleanFinished
+	s.duration.Describe(ch)
+}
+
+func (s *libraryScans) collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for media, finished := range s.scanFinished {
+		ch <- prometheus.MustNewConstMetric(
+			libraryLastScanFinished, prometheus.GaugeValue,
+			float64(finished.Unix()), media,
+		)
+	}
+	for media, finished := range s.cleanFinished {
+		ch <- prometheus.MustNewConstMetric(
+			libraryLastCleanFinished, prometheus.GaugeValue,
+			float64(finished.Unix()), media,
+		)
+	}
+	s.duration.Collect(ch)
+}
+
+func (e *Exporter) collectLibraryScanMetrics(ch chan<- prometheus.Metric) error {
+	resp, err := e.client.GetInfoBooleans([]string{scanningBoolean, videoScanningBoolean, musicScanningBoolean})
+	if err != nil || resp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+		err = rpcError(err, resp.Error)
+	} else {
+		now := time.Now()
+		for media, boolean := range map[string]string{
+			"video": videoScanningBoolean,
+			"music": musicScanningBoolean,
+		} {
+			scanning := resp.Result[boolean]
+			e.libraryScans.update(media, scanning, now)
+			ch <- prometheus.MustNewConstMetric(
+				libraryScanning, prometheus.GaugeValue, boolToFloat(scanning), media,
+			)
+		}
+		// Any library is being scanned: the scan durations are only
+		// tracked by media
+		ch <- prometheus.MustNewConstMetric(
+			libraryScanning, prometheus.GaugeValue, boolToFloat(resp.Result[scanningBoolean]), "all",
+		)
+	}
+	e.libraryScans.collect(ch)
+	return err
+}
+
+// SubscribeNotifications tracks the library scans and the library changes
+// using the notifications sent by Kodi
+func (e *Exporter) SubscribeNotifications(listener *kodi.NotificationsListener) {
+	e.libraryScans.subscribe(listener)
+	e.subscribeLibraryEvents(listener)
+}
+
+func init() {
+	registerCollector("library_scan", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectLibraryScanMetrics)
+	}, "Export the library scans state and durations.")
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+func TestLibraryScans(t *testing.T) {
+	scans := newLibraryScans(log.Base())
+	start := time.Date(2016, 7, 10, 3, 0, 0, 0, time.UTC)
+
+	// The notification and the polled state both report the scan
+	scans.update("video", true, start)
+	scans.update("video", true, start.Add(10*time.Second))
+	scans.update("video", false, start.Add(90*time.Second))
+	scans.update("video", false, start.Add(100*time.Second))
+	scans.update("music", false, start)
+
+	if finished := scans.scanFinished["video"]; !finished.Equal(start.Add(90 * time.Second)) {
+		t.Fatalf("Invalid last scan: %s", finished)
+	}
+	if _, ok := scans.scanFinished["music"]; ok {
+		t.Fatalf("Music library was not scanned")
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	scans.duration.Collect(ch)
+	close(ch)
+	for metric := range ch {
+		pb := &dto.Metric{}
+		if err := metric.Write(pb); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if pb.Histogram.GetSampleCount() != 1 || pb.Histogram.GetSampleSum() != 90 {
+			t.Fatalf("Invalid scan duration: %v", pb)
+		}
+	}
+}
+
+func TestLibraryScanCollector(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"XBMC.GetInfoBooleans": `{"id":1,"jsonrpc":"2.0","result":{"Library.IsScanning":true,"Library.IsScanningMusic":true,"Library.IsScanningVideo":false}}`,
+	})
+	defer h.Close()
+	e, err := New(Options{Client: client})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	if err := e.collectLibraryScanMetrics(ch); err != nil {
+		t.Fatalf("%v", err)
+	}
+	close(ch)
+	metrics := []prometheus.Metric{}
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	expected := map[string]float64{"media=all": 1, "media=music": 1, "media=video": 0}
+	if scanning := metricValues(t, metrics, libraryScanning); !reflect.DeepEqual(scanning, expected) {
+		t.Fatalf("Invalid scanning state: %v", scanning)
+	}
+	if _, ok := e.libraryScans.started["all"]; ok {
+		t.Fatalf("Scan durations should be tracked by media")
+	}
+}
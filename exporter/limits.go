@@ -0,0 +1,273 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// otherLabelValue is the label value of the series folding the series over
+// the limit
+const otherLabelValue = "other"
+
+var (
+	seriesLimiterLabels = labelNames("metric")
+
+	// limitedDescs are the metrics whose series could be limited, by
+	// descriptor. The series of the other metrics are always kept.
+	limitedDescs = struct {
+		sync.Mutex
+		descs map[*prometheus.Desc]*limitedDesc
+	}{descs: map[*prometheus.Desc]*limitedDesc{}}
+)
+
+// newLimitedDesc returns the descriptor of a metric whose series could be
+// limited, the series over the limit being dropped
+func newLimitedDesc(name, help string, labels []string) *prometheus.Desc {
+	return registerLimitedDesc(prometheus.NewDesc(name, help, labels, nil), &limitedDesc{name: name, labels: labels})
+}
+
+// newSummedDesc returns the descriptor of a count whose series could be
+// limited: the folded labels of the series over the limit are set to "other",
+// and their values are summed by the remaining labels
+func newSummedDesc(name, help string, labels []string, folded ...string) *prometheus.Desc {
+	return registerLimitedDesc(prometheus.NewDesc(name, help, labels, nil), &limitedDesc{name: name, labels: labels, folded: folded})
+}
+
+func registerLimitedDesc(desc *prometheus.Desc, d *limitedDesc) *prometheus.Desc {
+	limitedDescs.Lock()
+	limitedDescs.descs[desc] = d
+	limitedDescs.Unlock()
+	return desc
+}
+
+// lookupLimitedDesc returns the metric of a descriptor, nil if its series
+// are never limited
+func lookupLimitedDesc(desc *prometheus.Desc) *limitedDesc {
+	limitedDescs.Lock()
+	defer limitedDescs.Unlock()
+	return limitedDescs.descs[desc]
+}
+
+// seriesLimiter limits the series of the metrics: the series with the
+// highest values are kept. The others are dropped, or for the counts, the
+// labels with many values of the others are folded into series whose label
+// values are "other".
+type seriesLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	limits  map[string]int
+	folded  *prometheus.GaugeVec
+	dropped *prometheus.CounterVec
+	logger  log.Logger
+}
+
+// limitedDesc is the name, the variable labels and the folded labels of a
+// metric. The series over the limit are dropped if no label is folded.
+type limitedDesc struct {
+	name   string
+	labels []string
+	folded []string
+}
+
+// limitedSeries is a series of a metric, with its value
+type limitedSeries struct {
+	metric    prometheus.Metric
+	value     float64
+	valueType prometheus.ValueType
+	labels    map[string]string
+	key       string
+}
+
+func newSeriesLimiter(limit int, limits map[string]int, logger log.Logger) *seriesLimiter {
+	return &seriesLimiter{
+		limit:  limit,
+		limits: limits,
+		folded: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "kodi_exporter",
+			Name:      "series_folded",
+			Help:      "How many series of a metric are currently dropped or folded into the other series.",
+		}, seriesLimiterLabels),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kodi_exporter",
+			Name:      "series_dropped_total",
+			Help:      "How many series of a metric were dropped or folded into the other series.",
+		}, seriesLimiterLabels),
+		logger: logger,
+	}
+}
+
+func (l *seriesLimiter) describe(ch chan<- *prometheus.Desc) {
+	l.folded.Describe(ch)
+	l.dropped.Describe(ch)
+}
+
+func (l *seriesLimiter) collect(ch chan<- prometheus.Metric) {
+	l.folded.Collect(ch)
+	l.dropped.Collect(ch)
+}
+
+// limitOf returns the maximum number of series of a metric, 0 if unlimited
+func (l *seriesLimiter) limitOf(name string) int {
+	if limit, ok := l.limits[name]; ok {
+		return limit
+	}
+	return l.limit
+}
+
+func newLimitedSeries(metric prometheus.Metric, desc *limitedDesc) (*limitedSeries, bool) {
+	pb := &dto.Metric{}
+	if err := metric.Write(pb); err != nil {
+		return nil, false
+	}
+	s := &limitedSeries{metric: metric, labels: map[string]string{}}
+	switch {
+	case pb.Gauge != nil:
+		s.value, s.valueType = pb.Gauge.GetValue(), prometheus.GaugeValue
+	case pb.Counter != nil:
+		s.value, s.valueType = pb.Counter.GetValue(), prometheus.CounterValue
+	case pb.Untyped != nil:
+		s.value, s.valueType = pb.Untyped.GetValue(), prometheus.UntypedValue
+	default:
+		// Histograms and summaries can't be folded
+		return nil, false
+	}
+	for _, pair := range pb.Label {
+		s.labels[pair.GetName()] = pair.GetValue()
+	}
+	s.key = seriesKey(desc.labels, s.labels)
+	return s, true
+}
+
+// seriesKey returns the key of the label values of a series
+func seriesKey(names []string, labels map[string]string) string {
+	values := []string{}
+	for _, name := range names {
+		values = append(values, labels[name])
+	}
+	return strings.Join(values, "\xff")
+}
+
+// apply returns the metrics, with the series over the limits folded
+func (l *seriesLimiter) apply(metrics []prometheus.Metric) []prometheus.Metric {
+	if l.limit == 0 && len(l.limits) == 0 {
+		return metrics
+	}
+	byDesc := map[*prometheus.Desc][]prometheus.Metric{}
+	descs := []*prometheus.Desc{}
+	for _, metric := range metrics {
+		desc := metric.Desc()
+		if _, ok := byDesc[desc]; !ok {
+			descs = append(descs, desc)
+		}
+		byDesc[desc] = append(byDesc[desc], metric)
+	}
+	limited := []prometheus.Metric{}
+	for _, desc := range descs {
+		limited = append(limited, l.fold(desc, byDesc[desc])...)
+	}
+	return limited
+}
+
+// fold keeps the series of a metric with the highest values, ordered by
+// label values on ties. The others are dropped, or the folded labels of the
+// others are set to "other" and their values are summed by the remaining
+// labels.
+func (l *seriesLimiter) fold(desc *prometheus.Desc, metrics []prometheus.Metric) []prometheus.Metric {
+	d := lookupLimitedDesc(desc)
+	// The availability metrics are never limited
+	if d == nil || len(d.labels) == 0 || strings.HasSuffix(d.name, "_up") {
+		return metrics
+	}
+	limit := l.limitOf(d.name)
+	if limit <= 0 {
+		return metrics
+	}
+	if len(metrics) <= limit {
+		l.folded.WithLabelValues(d.name).Set(0)
+		return metrics
+	}
+	series := []*limitedSeries{}
+	for _, metric := range metrics {
+		s, ok := newLimitedSeries(metric, d)
+		if !ok {
+			return metrics
+		}
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].value != series[j].value {
+			return series[i].value > series[j].value
+		}
+		return series[i].key < series[j].key
+	})
+	dropped := len(series) - limit
+	l.folded.WithLabelValues(d.name).Set(float64(dropped))
+	l.dropped.WithLabelValues(d.name).Add(float64(dropped))
+	if len(d.folded) == 0 {
+		l.logger.Debugf("Metric %s: %d series dropped", d.name, dropped)
+		kept := []prometheus.Metric{}
+		for _, s := range series[:limit] {
+			kept = append(kept, s.metric)
+		}
+		return kept
+	}
+
+	// The kept series and the other series, by label values
+	result := []*limitedSeries{}
+	byKey := map[string]*limitedSeries{}
+	for _, s := range series[:limit] {
+		result = append(result, s)
+		byKey[s.key] = s
+	}
+	for _, s := range series[limit:] {
+		labels := map[string]string{}
+		for name, value := range s.labels {
+			labels[name] = value
+		}
+		for _, name := range d.folded {
+			labels[name] = otherLabelValue
+		}
+		key := seriesKey(d.labels, labels)
+		if other, ok := byKey[key]; ok {
+			other.value += s.value
+			other.metric = nil
+			continue
+		}
+		other := &limitedSeries{value: s.value, valueType: s.valueType, labels: labels, key: key}
+		result = append(result, other)
+		byKey[key] = other
+	}
+
+	kept := []prometheus.Metric{}
+	for _, s := range result {
+		if s.metric == nil {
+			labelValues := []string{}
+			for _, name := range d.labels {
+				labelValues = append(labelValues, s.labels[name])
+			}
+			s.metric = prometheus.MustNewConstMetric(desc, s.valueType, s.value, labelValues...)
+		}
+		kept = append(kept, s.metric)
+	}
+	l.logger.Debugf("Metric %s: %d series folded into %s", d.name, dropped, otherLabelValue)
+	return kept
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+func TestSeriesLimiter(t *testing.T) {
+	limiter := newSeriesLimiter(2, map[string]int{"kodi_source_up": 1}, log.Base())
+	metrics := []prometheus.Metric{}
+	for _, addons := range []struct {
+		addonType string
+		count     float64
+	}{
+		{"xbmc.python.script", 1},
+		{"xbmc.python.pluginsource", 3},
+		{"xbmc.gui.skin", 1},
+		{"xbmc.service", 2},
+		{"xbmc.metadata.scraper", 1},
+	} {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			addonsCount, prometheus.GaugeValue, addons.count, addons.addonType, "true",
+		))
+	}
+	for _, source := range []string{"Movies", "Music", "TV Shows"} {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			sourceUp, prometheus.GaugeValue, 1, "video", source, "smb",
+		))
+	}
+	metrics = append(metrics, prometheus.MustNewConstMetric(up, prometheus.GaugeValue, 1))
+
+	limited := limiter.apply(metrics)
+	if countMetrics(limited, sourceUp) != 3 || countMetrics(limited, up) != 1 {
+		t.Fatalf("Unlimited metrics should be kept: %v", limited)
+	}
+	series := []map[string]string{}
+	values := []float64{}
+	for _, metric := range limited {
+		if metric.Desc() != addonsCount {
+			continue
+		}
+		pb := &dto.Metric{}
+		metric.Write(pb)
+		series = append(series, metricLabels(t, metric))
+		values = append(values, pb.Gauge.GetValue())
+	}
+	if len(series) != 3 ||
+		series[0]["type"] != "xbmc.python.pluginsource" || values[0] != 3 ||
+		series[1]["type"] != "xbmc.service" || values[1] != 2 ||
+		series[2]["type"] != "other" || series[2]["enabled"] != "true" || values[2] != 3 {
+		t.Fatalf("Invalid folded series: %v %v", series, values)
+	}
+	if folded := foldedSeries(t, limiter, "kodi_addons"); folded != 3 {
+		t.Fatalf("Invalid folded series count: %f", folded)
+	}
+
+	// The count of the folded series doesn't grow on each refresh
+	limiter.apply(metrics[:3])
+	if folded := foldedSeries(t, limiter, "kodi_addons"); folded != 1 {
+		t.Fatalf("Invalid folded series count after refresh: %f", folded)
+	}
+	if dropped := droppedSeries(t, limiter, "kodi_addons"); dropped != 4 {
+		t.Fatalf("Invalid dropped series total: %f", dropped)
+	}
+}
+
+func droppedSeries(t *testing.T, limiter *seriesLimiter, name string) float64 {
+	pb := &dto.Metric{}
+	if err := limiter.dropped.WithLabelValues(name).Write(pb); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return pb.Counter.GetValue()
+}
+
+func foldedSeries(t *testing.T, limiter *seriesLimiter, name string) float64 {
+	pb := &dto.Metric{}
+	if err := limiter.folded.WithLabelValues(name).Write(pb); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return pb.Gauge.GetValue()
+}
+
+func TestSeriesLimiterFoldedLabels(t *testing.T) {
+	limiter := newSeriesLimiter(1, nil, log.Base())
+	metrics := []prometheus.Metric{}
+	for _, addon := range []struct {
+		addonType string
+		enabled   string
+		count     float64
+	}{
+		// A type named other is merged with the other series
+		{"other", "true", 5},
+		{"xbmc.python.script", "true", 1},
+		{"xbmc.service", "true", 2},
+		{"xbmc.gui.skin", "false", 4},
+	} {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			addonsCount, prometheus.GaugeValue, addon.count, addon.addonType, addon.enabled,
+		))
+	}
+
+	limited := limiter.apply(metrics)
+	values := map[string]float64{}
+	for _, metric := range limited {
+		labels := metricLabels(t, metric)
+		key := labels["type"] + "/" + labels["enabled"]
+		if _, ok := values[key]; ok {
+			t.Fatalf("Duplicated series: %v", labels)
+		}
+		pb := &dto.Metric{}
+		metric.Write(pb)
+		values[key] = pb.Gauge.GetValue()
+	}
+	expected := map[string]float64{"other/true": 8, "other/false": 4}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Invalid folded series: %v", values)
+	}
+	if folded := foldedSeries(t, limiter, "kodi_addons"); folded != 3 {
+		t.Fatalf("Invalid folded series count: %f", folded)
+	}
+}
+
+func TestSeriesLimiterDropped(t *testing.T) {
+	limiter := newSeriesLimiter(2, nil, log.Base())
+	metrics := []prometheus.Metric{}
+	for _, addon := range []string{"plugin.video.youtube", "script.module.requests", "service.xbmc.versioncheck"} {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			addonInfo, prometheus.GaugeValue, 1, addon, "1.0.0", "true",
+		))
+	}
+	limited := limiter.apply(metrics)
+	if len(limited) != 2 {
+		t.Fatalf("Invalid limited series: %v", limited)
+	}
+	for _, metric := range limited {
+		if labels := metricLabels(t, metric); labels["addonid"] == otherLabelValue {
+			t.Fatalf("The info series should not be folded: %v", labels)
+		}
+	}
+	if folded := foldedSeries(t, limiter, "kodi_addon_info"); folded != 1 {
+		t.Fatalf("Invalid dropped series count: %f", folded)
+	}
+}
+
+func TestSeriesLimiterDescs(t *testing.T) {
+	limiter := newSeriesLimiter(1, nil, log.Base())
+	custom, err := newRPCMetric("Addons.GetAddons", RPCMetricConfig{
+		Name: "kodi_addon_enabled", Each: "$.result.addons[*]", Labels: map[string]string{"addon": "$.addonid"},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	metrics := []prometheus.Metric{}
+	for _, name := range []string{"addons", "pvr", "sources"} {
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(scrapeCollectorSuccess, prometheus.GaugeValue, 1, name),
+			prometheus.MustNewConstMetric(custom.desc, prometheus.GaugeValue, 1, name),
+		)
+	}
+	limited := limiter.apply(metrics)
+	if countMetrics(limited, scrapeCollectorSuccess) != 3 {
+		t.Fatalf("The series of undeclared metrics should be kept: %v", limited)
+	}
+	if countMetrics(limited, custom.desc) != 1 {
+		t.Fatalf("The series of the custom metrics should be dropped: %v", limited)
+	}
+}
+
+func TestSeriesLimiterDisabled(t *testing.T) {
+	limiter := newSeriesLimiter(0, nil, log.Base())
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(addonsCount, prometheus.GaugeValue, 1, "a", "true"),
+		prometheus.MustNewConstMetric(addonsCount, prometheus.GaugeValue, 1, "b", "true"),
+	}
+	if limited := limiter.apply(metrics); len(limited) != 2 {
+		t.Fatalf("Series should not be limited: %v", limited)
+	}
+}
+
+func TestInvalidSeriesLimits(t *testing.T) {
+	for _, content := range []string{
+		"series_limits:\n  kodi_addon_info: -1\n",
+		"series_limits:\n  kodi-addon-info: 10\n",
+	} {
+		filename := writeConfig(t, content)
+		defer os.Remove(filename)
+		if _, err := LoadConfig(filename); err == nil {
+			t.Fatalf("Invalid series limits accepted: %s", content)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/robfig/cron"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	maintenanceSuccess = "success"
+	maintenanceSkipped = "skipped"
+	maintenanceError   = "error"
+)
+
+// maintenanceLabels are the labels of the runs counter
+var maintenanceLabels = labelNames("job", "result")
+
+// maintenanceActions are the library maintenance RPC calls
+var maintenanceActions = map[string]func(*kodi.Client) (*kodi.ActionResponse, error){
+	"video_scan":  (*kodi.Client).VideoScan,
+	"video_clean": (*kodi.Client).VideoClean,
+	"audio_scan":  (*kodi.Client).AudioScan,
+	"audio_clean": (*kodi.Client).AudioClean,
+}
+
+// MaintenanceOptions are the options of a Maintenance
+type MaintenanceOptions struct {
+	// Client queries the Kodi server. It is required.
+	Client *kodi.Client
+	// Jobs are the library maintenance jobs of the configuration
+	Jobs []MaintenanceConfig
+	// Logger defaults to the base logger
+	Logger log.Logger
+}
+
+// Maintenance runs the library maintenance jobs of the configuration.
+// It implements prometheus.Collector.
+type Maintenance struct {
+	client *kodi.Client
+	jobs   []MaintenanceConfig
+	cron   *cron.Cron
+	runs   *prometheus.CounterVec
+	logger log.Logger
+}
+
+// NewMaintenance returns the scheduler of the library maintenance jobs
+func NewMaintenance(opts MaintenanceOptions) (*Maintenance, error) {
+	if opts.Client == nil {
+		return nil, fmt.Errorf("Kodi client not configured")
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Base()
+	}
+	m := &Maintenance{
+		client: opts.Client,
+		jobs:   opts.Jobs,
+		cron:   cron.New(),
+		logger: logger,
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "maintenance",
+			Name:      "runs_total",
+			Help:      "How many library maintenance jobs were run.",
+		}, maintenanceLabels),
+	}
+	for _, job := range opts.Jobs {
+		if err := job.validate(); err != nil {
+			return nil, err
+		}
+		schedule, _ := cron.ParseStandard(job.Schedule)
+		job := job
+		m.cron.Schedule(schedule, cron.FuncJob(func() {
+			m.run(job)
+		}))
+		for _, result := range []string{maintenanceSuccess, maintenanceSkipped, maintenanceError} {
+			m.runs.WithLabelValues(job.Name, result)
+		}
+	}
+	return m, nil
+}
+
+// Start runs the scheduler in background
+func (m *Maintenance) Start() {
+	m.cron.Start()
+}
+
+// Stop stops the scheduler
+func (m *Maintenance) Stop() {
+	m.cron.Stop()
+}
+
+func (m *Maintenance) run(job MaintenanceConfig) string {
+	result, err := m.runJob(job)
+	if err != nil {
+		m.logger.Errorf("Maintenance job %s failed: %s", job.Name, err)
+	} else {
+		m.logger.Infof("Maintenance job %s: %s", job.Name, result)
+	}
+	m.runs.WithLabelValues(job.Name, result).Inc()
+	return result
+}
+
+func (m *Maintenance) runJob(job MaintenanceConfig) (string, error) {
+	// Don't disturb someone watching a movie
+	players, err := m.client.PlayerGetActivePlayers()
+	if err != nil {
+		return maintenanceError, err
+	}
+	if players.Error != nil {
+		return maintenanceError, fmt.Errorf("%s [%d]", players.Error.Message, players.Error.Code)
+	}
+	if len(players.Result) > 0 {
+		return maintenanceSkipped, nil
+	}
+
+	resp, err := maintenanceActions[job.Action](m.client)
+	if err != nil {
+		return maintenanceError, err
+	}
+	if resp.Error != nil {
+		return maintenanceError, fmt.Errorf("%s [%d]", resp.Error.Message, resp.Error.Code)
+	}
+	return maintenanceSuccess, nil
+}
+
+// Describe implements prometheus.Collector.
+func (m *Maintenance) Describe(ch chan<- *prometheus.Desc) {
+	m.runs.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Maintenance) Collect(ch chan<- prometheus.Metric) {
+	m.runs.Collect(ch)
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	noActivePlayers = `{"id":1,"jsonrpc":"2.0","result":[]}`
+	activePlayer    = `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`
+)
+
+func TestMaintenanceJobs(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		job       MaintenanceConfig
+		responses map[string]string
+		result    string
+		method    string
+		calls     int
+	}{
+		{
+			name: "scan",
+			job:  MaintenanceConfig{Name: "nightly-scan", Action: "video_scan", Schedule: "0 3 * * *"},
+			responses: map[string]string{
+				"Player.GetActivePlayers": noActivePlayers,
+				"VideoLibrary.Scan":       `{"id":1,"jsonrpc":"2.0","result":"OK"}`,
+			},
+			result: maintenanceSuccess,
+			method: "VideoLibrary.Scan",
+			calls:  1,
+		},
+		{
+			name: "failed clean",
+			job:  MaintenanceConfig{Name: "weekly-clean", Action: "audio_clean", Schedule: "0 4 * * 0"},
+			responses: map[string]string{
+				"Player.GetActivePlayers": noActivePlayers,
+			},
+			result: maintenanceError,
+			method: "AudioLibrary.Clean",
+			calls:  1,
+		},
+		{
+			name: "scan while playing",
+			job:  MaintenanceConfig{Name: "nightly-scan", Action: "video_scan", Schedule: "0 3 * * *"},
+			responses: map[string]string{
+				"Player.GetActivePlayers": activePlayer,
+				"VideoLibrary.Scan":       `{"id":1,"jsonrpc":"2.0","result":"OK"}`,
+			},
+			result: maintenanceSkipped,
+			method: "VideoLibrary.Scan",
+			calls:  0,
+		},
+		{
+			name:      "Kodi down",
+			job:       MaintenanceConfig{Name: "nightly-scan", Action: "video_scan", Schedule: "0 3 * * *"},
+			responses: map[string]string{},
+			result:    maintenanceError,
+			method:    "VideoLibrary.Scan",
+			calls:     0,
+		},
+	} {
+		recorder := &kodiRecorder{responses: tc.responses, strict: true}
+		h := httptest.NewServer(recorder)
+		m, err := NewMaintenance(MaintenanceOptions{
+			Client: newTestClient(t, h.URL),
+			Jobs:   []MaintenanceConfig{tc.job},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		result := m.run(tc.job)
+		h.Close()
+		if result != tc.result {
+			t.Fatalf("%s: invalid result: %s", tc.name, result)
+		}
+		if calls := recorder.called(tc.method); calls != tc.calls {
+			t.Fatalf("%s: invalid calls of %s: %v", tc.name, tc.method, recorder.calls)
+		}
+		if runs := counterValue(t, m.runs.WithLabelValues(tc.job.Name, tc.result)); runs != 1 {
+			t.Fatalf("%s: invalid runs: %f", tc.name, runs)
+		}
+	}
+}
+
+func TestInvalidMaintenanceJob(t *testing.T) {
+	for _, job := range []MaintenanceConfig{
+		{Name: "scan", Action: "video_update", Schedule: "0 3 * * *"},
+		{Name: "scan", Action: "video_scan", Schedule: "every night"},
+		{Action: "video_scan", Schedule: "0 3 * * *"},
+	} {
+		if _, err := NewMaintenance(MaintenanceOptions{
+			Client: newTestClient(t, "http://kodi:8080"),
+			Jobs:   []MaintenanceConfig{job},
+		}); err == nil {
+			t.Fatalf("Invalid job accepted: %v", job)
+		}
+	}
+	if _, err := NewMaintenance(MaintenanceOptions{}); err == nil {
+		t.Fatalf("Maintenance without client accepted")
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var lastRefresh = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "last_refresh_timestamp_seconds"),
+	"When the metrics of a collector were last refreshed.",
+	labelNames("collector"), nil,
+)
+
+// snapshot is the metrics of a sub-collector, cached between the refreshes
+type snapshot struct {
+	metrics   []prometheus.Metric
+	refreshed time.Time
+	err       error
+	// generation is the generation of the sub-collector when it was
+	// refreshed. It is increased when the metrics are invalidated.
+	generation uint64
+}
+
+// snapshots are the cached metrics of the exporter
+type snapshots struct {
+	mu          sync.Mutex
+	up          []prometheus.Metric
+	collectors  map[string]*snapshot
+	generations map[string]uint64
+	refreshing  map[string]*sync.Mutex
+}
+
+// refreshLock returns the lock serializing the refreshes of a sub-collector
+func (s *snapshots) refreshLock(name string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refreshing == nil {
+		s.refreshing = map[string]*sync.Mutex{}
+	}
+	lock, ok := s.refreshing[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.refreshing[name] = lock
+	}
+	return lock
+}
+
+// gather returns the metrics of a collect function
+func gather(collect func(ch chan<- prometheus.Metric)) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		metrics := []prometheus.Metric{}
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		done <- metrics
+	}()
+	collect(ch)
+	close(ch)
+	return <-done
+}
+
+// StartPolling queries Kodi in background every PollInterval. Collect then
+// serves the cached metrics.
+func (e *Exporter) StartPolling() {
+	go func() {
+		ticker := time.NewTicker(e.pollInterval)
+		defer ticker.Stop()
+		for {
+			e.refresh()
+			<-ticker.C
+		}
+	}()
+}
+
+// refresh queries Kodi, and caches the metrics of the sub-collectors. If
+// Kodi is down, the previous metrics are kept until they are stale.
+func (e *Exporter) refresh() {
+	reached := false
+	up := gather(func(ch chan<- prometheus.Metric) {
+		reached = e.ping(ch)
+	})
+	e.snapshots.mu.Lock()
+	e.snapshots.up = up
+	e.snapshots.mu.Unlock()
+	if !reached {
+		return
+	}
+	e.resolveInstance()
+	now := time.Now()
+	for _, c := range e.subCollectors() {
+		e.refreshCollector(c, now)
+	}
+}
+
+// refreshCollector returns the metrics of a sub-collector, refreshed if the
+// cached metrics are older than its refresh interval. The refreshes of a
+// sub-collector are serialized: the concurrent scrapes waiting for a refresh
+// share its metrics.
+func (e *Exporter) refreshCollector(c subCollector, now time.Time) *snapshot {
+	lock := e.snapshots.refreshLock(c.name)
+	e.snapshots.mu.Lock()
+	previous := e.snapshots.collectors[c.name]
+	e.snapshots.mu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	e.snapshots.mu.Lock()
+	s, ok := e.snapshots.collectors[c.name]
+	generation := e.snapshots.generations[c.name]
+	e.snapshots.mu.Unlock()
+	if ok && s.generation == generation && (s != previous || now.Sub(s.refreshed) < e.refreshInterval(c.name)) {
+		return s
+	}
+	s = &snapshot{refreshed: now, generation: generation}
+	s.metrics = gather(func(ch chan<- prometheus.Metric) {
+		s.err = c.collector.Update(ch)
+	})
+	s.metrics = e.limiter.apply(s.metrics)
+	if s.err != nil {
+		e.logger.Errorf("Collector %s failed: %s", c.name, s.err)
+	}
+	e.snapshots.mu.Lock()
+	e.snapshots.collectors[c.name] = s
+	e.snapshots.mu.Unlock()
+	return s
+}
+
+// collectSnapshots delivers the cached metrics, dropping the stale ones: the
+// metrics not refreshed during Staleness after their refresh interval
+func (e *Exporter) collectSnapshots(ch chan<- prometheus.Metric, now time.Time) {
+	e.snapshots.mu.Lock()
+	defer e.snapshots.mu.Unlock()
+	for _, metric := range e.snapshots.up {
+		ch <- metric
+	}
+	for name, s := range e.snapshots.collectors {
+		if e.staleness > 0 && now.Sub(s.refreshed) > e.refreshInterval(name)+e.staleness {
+			e.logger.Debugf("Metrics of %s are stale: %s", name, s.refreshed)
+			continue
+		}
+		s.collect(ch, name)
+	}
+}
+
+// collect delivers the metrics of a snapshot, with the state of its collector
+func (s *snapshot) collect(ch chan<- prometheus.Metric, name string) {
+	for _, metric := range s.metrics {
+		ch <- metric
+	}
+	ch <- prometheus.MustNewConstMetric(
+		lastRefresh, prometheus.GaugeValue, float64(s.refreshed.Unix()), name,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		scrapeCollectorSuccess, prometheus.GaugeValue, boolToFloat(s.err == nil), name,
+	)
+}
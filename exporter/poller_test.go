@@ -0,0 +1,149 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func countMetrics(metrics []prometheus.Metric, desc *prometheus.Desc) int {
+	count := 0
+	for _, metric := range metrics {
+		if metric.Desc() == desc {
+			count++
+		}
+	}
+	return count
+}
+
+func TestExporterPolling(t *testing.T) {
+	h, _ := newKodiRPCServer(t, map[string]string{
+		"JSONRPC.Ping":         `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+		"XBMC.GetInfoLabels":   `{"id":1,"jsonrpc":"2.0","result":{"System.FPS":"60.00"}}`,
+		"XBMC.GetInfoBooleans": `{"id":1,"jsonrpc":"2.0","result":{}}`,
+	})
+	e, err := New(Options{Client: newTestClient(t, h.URL)})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	e.pollInterval = time.Minute
+	e.staleness = 5 * time.Minute
+	e.refresh()
+
+	now := time.Now()
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		e.Collect(ch)
+	})
+	if countMetrics(metrics, up) != 1 || countMetrics(metrics, fps) != 1 {
+		t.Fatalf("Invalid cached metrics: %v", metrics)
+	}
+	if refreshed := countMetrics(metrics, lastRefresh); refreshed != len(e.subCollectors()) {
+		t.Fatalf("Invalid refresh timestamps: %d", refreshed)
+	}
+
+	// Kodi is switched off: the cached metrics are kept until they are stale
+	h.Close()
+	e.refresh()
+	metrics = gather(func(ch chan<- prometheus.Metric) {
+		e.collectSnapshots(ch, now.Add(time.Minute))
+	})
+	if countMetrics(metrics, up) != 1 || countMetrics(metrics, fps) != 1 {
+		t.Fatalf("Cached metrics should be kept: %v", metrics)
+	}
+	metrics = gather(func(ch chan<- prometheus.Metric) {
+		e.collectSnapshots(ch, now.Add(10*time.Minute))
+	})
+	if len(metrics) != 1 || countMetrics(metrics, up) != 1 {
+		t.Fatalf("Stale metrics should be dropped: %v", metrics)
+	}
+}
+
+func TestRefreshIntervals(t *testing.T) {
+	recorder := &kodiRecorder{responses: map[string]string{
+		"JSONRPC.Ping":            `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+		"AudioLibrary.GetSongs":   `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":0,"start":0,"total":0},"songs":[]}}`,
+		"Player.GetActivePlayers": `{"id":1,"jsonrpc":"2.0","result":[]}`,
+	}}
+	h := httptest.NewServer(recorder)
+	defer h.Close()
+	e, err := New(Options{
+		Client:     newTestClient(t, h.URL),
+		Collectors: map[string]bool{"library_changes": false},
+		Config: &Config{
+			RefreshIntervals: map[string]time.Duration{"audio": time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		metrics := gather(func(ch chan<- prometheus.Metric) {
+			e.Collect(ch)
+		})
+		if countMetrics(metrics, songCount) != 1 {
+			t.Fatalf("Cached library metrics should be served: %v", metrics)
+		}
+	}
+	if songs := recorder.called("AudioLibrary.GetSongs"); songs != 1 {
+		t.Fatalf("Library should be refreshed once: %d", songs)
+	}
+	if players := recorder.called("Player.GetActivePlayers"); players != 3 {
+		t.Fatalf("Player should be refreshed on each scrape: %d", players)
+	}
+}
+
+func TestConcurrentRefreshes(t *testing.T) {
+	recorder := &kodiRecorder{responses: map[string]string{
+		"JSONRPC.Ping":          `{"id":1,"jsonrpc":"2.0","result":"pong"}`,
+		"AudioLibrary.GetSongs": `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":0,"start":0,"total":0},"songs":[]}}`,
+	}, delay: 20 * time.Millisecond}
+	h := httptest.NewServer(recorder)
+	defer h.Close()
+	e, err := New(Options{
+		Client:     newTestClient(t, h.URL),
+		Collectors: map[string]bool{"library_changes": false},
+		Config: &Config{
+			RefreshIntervals: map[string]time.Duration{"audio": time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var wg sync.WaitGroup
+	counts := make([]int, 5)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i] = countMetrics(gather(e.Collect), songCount)
+		}(i)
+	}
+	wg.Wait()
+	for _, count := range counts {
+		if count != 1 {
+			t.Fatalf("The library metrics should be served to all the scrapes: %v", counts)
+		}
+	}
+	if songs := recorder.called("AudioLibrary.GetSongs"); songs != 1 {
+		t.Fatalf("Library should be refreshed once by the concurrent scrapes: %d", songs)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+var (
+	pvrAvailable = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pvr", "available"),
+		"Is the PVR available.",
+		nil, nil,
+	)
+	pvrRecording = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pvr", "recording_active"),
+		"Is the PVR recording.",
+		nil, nil,
+	)
+	pvrScanning = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pvr", "scanning"),
+		"Is the PVR scanning for channels.",
+		nil, nil,
+	)
+	pvrChannelGroups = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pvr", "channel_groups"),
+		"How many channel groups are available in the PVR.",
+		labelNames("type"), nil,
+	)
+	pvrChannels = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pvr", "channels"),
+		"How many channels are available in the PVR.",
+		labelNames("type"), nil,
+	)
+	pvrRecordings = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pvr", "recordings"),
+		"How many recordings are available in the PVR.",
+		nil, nil,
+	)
+	pvrTimers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pvr", "timers"),
+		"How many timers are defined in the PVR.",
+		labelNames("state"), nil,
+	)
+	pvrNowPlaying = newLimitedDesc(
+		prometheus.BuildFQName(namespace, "pvr", "now_playing_info"),
+		"Program currently played on a live TV or radio channel.",
+		labelNames("channel", "program", "genre"),
+	)
+	pvrNextProgram = newLimitedDesc(
+		prometheus.BuildFQName(namespace, "pvr", "next_program_info"),
+		"Next program on the played live TV or radio channel.",
+		labelNames("channel", "program", "genre"),
+	)
+	pvrProgramProgress = newLimitedDesc(
+		prometheus.BuildFQName(namespace, "pvr", "program_progress_ratio"),
+		"Progress of the program currently played on a live TV or radio channel.",
+		labelNames("channel"),
+	)
+)
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func listTotal(limits *kodi.ListLimitsReturned, size int) float64 {
+	if limits == nil {
+		return float64(size)
+	}
+	return float64(limits.Total)
+}
+
+func (e *Exporter) collectPVRMetrics(ch chan<- prometheus.Metric) error {
+	propertiesResp, err := e.client.PVRGetProperties()
+	if err != nil || propertiesResp.Error != nil {
+		// Kodi fails to execute the PVR methods if the PVR is not enabled
+		if err == nil && propertiesResp.Error.Code == kodi.FailedToExecuteCode {
+			e.logger.Debugf("PVR not available: %v", propertiesResp.Error)
+			ch <- prometheus.MustNewConstMetric(
+				pvrAvailable, prometheus.GaugeValue, 0,
+			)
+			return nil
+		}
+		e.logger.Errorf("Kodi error : %v %v", err, propertiesResp.Error)
+		return rpcError(err, propertiesResp.Error)
+	}
+	properties := propertiesResp.Result
+	ch <- prometheus.MustNewConstMetric(
+		pvrAvailable, prometheus.GaugeValue, boolToFloat(properties.Available),
+	)
+	if !properties.Available {
+		return nil
+	}
+	ch <- prometheus.MustNewConstMetric(
+		pvrRecording, prometheus.GaugeValue, boolToFloat(properties.Recording),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		pvrScanning, prometheus.GaugeValue, boolToFloat(properties.Scanning),
+	)
+
+	var lastErr error
+	for _, channelType := range []string{"tv", "radio"} {
+		groupsResp, err := e.client.PVRGetChannelGroups(channelType)
+		if err != nil || groupsResp.Error != nil {
+			e.logger.Errorf("Kodi error : %v %v", err, groupsResp.Error)
+			lastErr = rpcError(err, groupsResp.Error)
+		} else {
+			ch <- prometheus.MustNewConstMetric(
+				pvrChannelGroups, prometheus.GaugeValue,
+				listTotal(groupsResp.Result.Limits, len(groupsResp.Result.ChannelGroups)),
+				channelType,
+			)
+		}
+	}
+
+	tvResp, err := e.client.PVRGetTVChannels()
+	if err != nil || tvResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, tvResp.Error)
+		lastErr = rpcError(err, tvResp.Error)
+	} else {
+		ch <- prometheus.MustNewConstMetric(
+			pvrChannels, prometheus.GaugeValue,
+			listTotal(tvResp.Result.Limits, len(tvResp.Result.Channels)),
+			"tv",
+		)
+	}
+	radioResp, err := e.client.PVRGetRadioChannels()
+	if err != nil || radioResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, radioResp.Error)
+		lastErr = rpcError(err, radioResp.Error)
+	} else {
+		ch <- prometheus.MustNewConstMetric(
+			pvrChannels, prometheus.GaugeValue,
+			listTotal(radioResp.Result.Limits, len(radioResp.Result.Channels)),
+			"radio",
+		)
+	}
+
+	recordingsResp, err := e.client.PVRGetRecordings()
+	if err != nil || recordingsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, recordingsResp.Error)
+		lastErr = rpcError(err, recordingsResp.Error)
+	} else {
+		ch <- prometheus.MustNewConstMetric(
+			pvrRecordings, prometheus.GaugeValue,
+			listTotal(recordingsResp.Result.Limits, len(recordingsResp.Result.Recordings)),
+		)
+	}
+
+	timersResp, err := e.client.PVRGetTimers()
+	if err != nil || timersResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, timersResp.Error)
+		lastErr = rpcError(err, timersResp.Error)
+	} else {
+		states := map[string]int{}
+		for _, timer := range timersResp.Result.Timers {
+			states[timer.State]++
+		}
+		for state, count := range states {
+			ch <- prometheus.MustNewConstMetric(
+				pvrTimers, prometheus.GaugeValue, float64(count), state,
+			)
+		}
+	}
+	return lastErr
+}
+
+func broadcastTimes(broadcast *kodi.Broadcast) (time.Time, time.Time, bool) {
+	start, err := time.Parse(kodi.BroadcastTimeLayout, broadcast.StartTime)
+	if err != nil {
+		return start, start, false
+	}
+	end, err := time.Parse(kodi.BroadcastTimeLayout, broadcast.EndTime)
+	if err != nil || !end.After(start) {
+		return start, end, false
+	}
+	return start, end, true
+}
+
+// currentBroadcasts find the broadcasts on air and next in an EPG
+func currentBroadcasts(broadcasts []kodi.Broadcast, now time.Time) (*kodi.Broadcast, *kodi.Broadcast) {
+	var current, next *kodi.Broadcast
+	var nextStart time.Time
+	for i := range broadcasts {
+		broadcast := &broadcasts[i]
+		start, end, ok := broadcastTimes(broadcast)
+		if !ok {
+			continue
+		}
+		if !now.Before(start) && now.Before(end) {
+			current = broadcast
+		} else if start.After(now) && (next == nil || start.Before(nextStart)) {
+			next = broadcast
+			nextStart = start
+		}
+	}
+	return current, next
+}
+
+// broadcastProgress returns the progress of a broadcast, between 0 and 1
+func broadcastProgress(broadcast *kodi.Broadcast, now time.Time) (float64, bool) {
+	if broadcast.ProgressPercentage > 0 {
+		return broadcast.ProgressPercentage / 100, true
+	}
+	start, end, ok := broadcastTimes(broadcast)
+	if !ok {
+		return 0, false
+	}
+	progress := now.Sub(start).Seconds() / end.Sub(start).Seconds()
+	if progress < 0 || progress > 1 {
+		return 0, false
+	}
+	return progress, true
+}
+
+func broadcastGenre(broadcast *kodi.Broadcast) string {
+	return strings.Join(broadcast.Genre, " / ")
+}
+
+func (e *Exporter) collectPVRPlayingMetrics(ch chan<- prometheus.Metric) error {
+	playersResp, err := e.client.PlayerGetActivePlayers()
+	if err != nil || playersResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, playersResp.Error)
+		return rpcError(err, playersResp.Error)
+	}
+	var lastErr error
+	for _, player := range playersResp.Result {
+		itemResp, err := e.client.PlayerGetItem(player.PlayerID)
+		if err != nil || itemResp.Error != nil {
+			e.logger.Errorf("Kodi error : %v %v", err, itemResp.Error)
+			lastErr = rpcError(err, itemResp.Error)
+			continue
+		}
+		item := itemResp.Result.Item
+		if item.Type != "channel" {
+			continue
+		}
+
+		detailsResp, err := e.client.PVRGetChannelDetails(item.ID)
+		if err != nil || detailsResp.Error != nil {
+			e.logger.Errorf("Kodi error : %v %v", err, detailsResp.Error)
+			lastErr = rpcError(err, detailsResp.Error)
+			continue
+		}
+		details := detailsResp.Result.ChannelDetails
+		channel := details.Label
+		if len(channel) == 0 {
+			channel = item.Channel
+		}
+		now := time.Now()
+		current, next := details.BroadcastNow, details.BroadcastNext
+		if current == nil {
+			// Fallback to the EPG of the channel
+			broadcastsResp, err := e.client.PVRGetBroadcasts(item.ID)
+			if err != nil || broadcastsResp.Error != nil {
+				e.logger.Errorf("Kodi error : %v %v", err, broadcastsResp.Error)
+				lastErr = rpcError(err, broadcastsResp.Error)
+				continue
+			}
+			current, next = currentBroadcasts(broadcastsResp.Result.Broadcasts, now.UTC())
+		}
+		if current == nil {
+			e.logger.Debugf("No EPG information for channel %s", channel)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			pvrNowPlaying, prometheus.GaugeValue, 1,
+			channel, current.Title, broadcastGenre(current),
+		)
+		if progress, ok := broadcastProgress(current, now.UTC()); ok {
+			ch <- prometheus.MustNewConstMetric(
+				pvrProgramProgress, prometheus.GaugeValue, progress, channel,
+			)
+		}
+		if next != nil {
+			ch <- prometheus.MustNewConstMetric(
+				pvrNextProgram, prometheus.GaugeValue, 1,
+				channel, next.Title, broadcastGenre(next),
+			)
+		}
+		e.logger.Infof("Live TV: %s - %s", channel, current.Title)
+	}
+	return lastErr
+}
+
+func init() {
+	registerCollector("pvr", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectPVRMetrics)
+	}, "Export the PVR metrics.")
+	registerCollector("player", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectPVRPlayingMetrics)
+	}, "Export the played live TV programs.")
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+var broadcasts = []kodi.Broadcast{
+	{BroadcastID: 1, Title: "Le journal", StartTime: "2016-07-10 18:00:00", EndTime: "2016-07-10 18:30:00"},
+	{BroadcastID: 3, Title: "Le film", StartTime: "2016-07-10 18:35:00", EndTime: "2016-07-10 20:00:00"},
+	{BroadcastID: 2, Title: "Météo", StartTime: "2016-07-10 18:30:00", EndTime: "2016-07-10 18:35:00"},
+	{BroadcastID: 4, Title: "Invalid", StartTime: "", EndTime: ""},
+}
+
+func TestCurrentBroadcasts(t *testing.T) {
+	now := time.Date(2016, 7, 10, 18, 15, 0, 0, time.UTC)
+	current, next := currentBroadcasts(broadcasts, now)
+	if current == nil || current.BroadcastID != 1 {
+		t.Fatalf("Invalid current broadcast: %v", current)
+	}
+	if next == nil || next.BroadcastID != 2 {
+		t.Fatalf("Invalid next broadcast: %v", next)
+	}
+	progress, ok := broadcastProgress(current, now)
+	if !ok || progress != 0.5 {
+		t.Fatalf("Invalid progress: %f", progress)
+	}
+
+	current, next = currentBroadcasts(broadcasts, now.Add(24*time.Hour))
+	if current != nil || next != nil {
+		t.Fatalf("Invalid broadcasts: %v %v", current, next)
+	}
+}
+
+func TestPVRMetrics(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"PVR.GetProperties":    `{"id":1,"jsonrpc":"2.0","result":{"available":true,"recording":true,"scanning":false}}`,
+		"PVR.GetChannelGroups": `{"id":1,"jsonrpc":"2.0","result":{"channelgroups":[{"channelgroupid":1,"channeltype":"tv","label":"All channels"},{"channelgroupid":3,"channeltype":"tv","label":"Favourites"}],"limits":{"end":2,"start":0,"total":2}}}`,
+		"PVR.GetChannels":      `{"id":1,"jsonrpc":"2.0","result":{"channels":[{"channelid":1,"label":"France 2"},{"channelid":2,"label":"Arte"},{"channelid":3,"label":"France 5"}],"limits":{"end":3,"start":0,"total":3}}}`,
+		"PVR.GetRecordings":    `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":1,"start":0,"total":1},"recordings":[{"label":"Le journal","recordingid":1}]}}`,
+		"PVR.GetTimers":        `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":3,"start":0,"total":3},"timers":[{"label":"Le journal","state":"recording","timerid":1},{"label":"Arte Reportage","state":"scheduled","timerid":2},{"label":"Météo","state":"scheduled","timerid":3}]}}`,
+	})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectPVRMetrics(ch)
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for desc, expected := range map[*prometheus.Desc]map[string]float64{
+		pvrAvailable:     {"": 1},
+		pvrRecording:     {"": 1},
+		pvrScanning:      {"": 0},
+		pvrChannelGroups: {"type=tv": 2, "type=radio": 2},
+		pvrChannels:      {"type=tv": 3, "type=radio": 3},
+		pvrRecordings:    {"": 1},
+		pvrTimers:        {"state=recording": 1, "state=scheduled": 2},
+	} {
+		if values := metricValues(t, metrics, desc); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Invalid values of %s: %v", desc, values)
+		}
+	}
+}
+
+func TestPVRNotEnabled(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"PVR.GetProperties": `{"error":{"code":-32100,"message":"Failed to execute method."},"id":1,"jsonrpc":"2.0"}`,
+	})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectPVRMetrics(ch)
+	})
+	// The collector succeeds: the PVR is just not enabled
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Only the availability should be exported: %v", metrics)
+	}
+	if values := metricValues(t, metrics, pvrAvailable); !reflect.DeepEqual(values, map[string]float64{"": 0}) {
+		t.Fatalf("Invalid PVR availability: %v", values)
+	}
+}
+
+func TestPVRKodiError(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"PVR.GetProperties": `{"error":{"code":-32602,"message":"Invalid params."},"id":1,"jsonrpc":"2.0"}`,
+	})
+	e := &Exporter{client: client, logger: log.Base()}
+	if metrics := gather(func(ch chan<- prometheus.Metric) {
+		if err := e.collectPVRMetrics(ch); err == nil {
+			t.Fatalf("The Kodi error should be reported")
+		}
+	}); len(metrics) != 0 {
+		t.Fatalf("No metrics should be exported: %v", metrics)
+	}
+
+	// The collector fails while Kodi is down
+	h.Close()
+	if metrics := gather(func(ch chan<- prometheus.Metric) {
+		if err := e.collectPVRMetrics(ch); err == nil {
+			t.Fatalf("The connection error should be reported")
+		}
+	}); len(metrics) != 0 {
+		t.Fatalf("No metrics should be exported: %v", metrics)
+	}
+}
+
+func TestPVRPlayingMetrics(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"Player.GetActivePlayers": `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`,
+		"Player.GetItem":          `{"id":1,"jsonrpc":"2.0","result":{"item":{"channel":"France 2","channeltype":"tv","id":1,"label":"France 2","title":"Le journal","type":"channel"}}}`,
+		"PVR.GetChannelDetails":   `{"id":1,"jsonrpc":"2.0","result":{"channeldetails":{"broadcastnext":{"broadcastid":12,"genre":["News"],"label":"Météo","title":"Météo"},"broadcastnow":{"broadcastid":11,"endtime":"2016-07-10 18:30:00","genre":["News","Magazine"],"label":"Le journal","progresspercentage":42.5,"starttime":"2016-07-10 18:00:00","title":"Le journal"},"channelid":1,"channeltype":"tv","label":"France 2"}}}`,
+	})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectPVRPlayingMetrics(ch)
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for desc, expected := range map[*prometheus.Desc]map[string]float64{
+		pvrNowPlaying:      {"channel=France 2,genre=News / Magazine,program=Le journal": 1},
+		pvrNextProgram:     {"channel=France 2,genre=News,program=Météo": 1},
+		pvrProgramProgress: {"channel=France 2": 0.425},
+	} {
+		if values := metricValues(t, metrics, desc); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Invalid values of %s: %v", desc, values)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+// rpcMetrics holds the metrics extracted from the result of a JSONRPC call
+type rpcMetrics struct {
+	method  string
+	params  interface{}
+	metrics []*rpcMetric
+}
+
+type rpcMetric struct {
+	desc       *prometheus.Desc
+	valueType  prometheus.ValueType
+	each       *jsonPath
+	value      *jsonPath
+	labelNames []string
+	labels     []*jsonPath
+}
+
+func newRPCMetrics(configs []RPCMetricsConfig) ([]*rpcMetrics, error) {
+	var calls []*rpcMetrics
+	for _, config := range configs {
+		call := &rpcMetrics{
+			method: config.Method,
+		}
+		if config.Params != nil {
+			call.params = normalizeYAML(config.Params)
+		}
+		for _, metricConfig := range config.Metrics {
+			metric, err := newRPCMetric(config.Method, metricConfig)
+			if err != nil {
+				return nil, err
+			}
+			call.metrics = append(call.metrics, metric)
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+func newRPCMetric(method string, config RPCMetricConfig) (*rpcMetric, error) {
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("Method %s: %s", method, err)
+	}
+	metric := &rpcMetric{
+		valueType: valueTypes[config.Type],
+	}
+	if len(config.Each) > 0 {
+		metric.each, _ = parseJSONPath(config.Each)
+	}
+	if len(config.Value) > 0 {
+		metric.value, _ = parseJSONPath(config.Value)
+	}
+	for name := range config.Labels {
+		metric.labelNames = append(metric.labelNames, name)
+	}
+	sort.Strings(metric.labelNames)
+	for _, name := range metric.labelNames {
+		path, _ := parseJSONPath(config.Labels[name])
+		metric.labels = append(metric.labels, path)
+	}
+	help := config.Help
+	if len(help) == 0 {
+		help = fmt.Sprintf("Kodi %s.", method)
+	}
+	metric.desc = newLimitedDesc(config.Name, help, metric.labelNames)
+	return metric, nil
+}
+
+// normalizeYAML converts the maps decoded by the YAML parser into maps
+// which could be encoded in JSON
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprintf("%v", key)] = normalizeYAML(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[key] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, item := range v {
+			l[i] = normalizeYAML(item)
+		}
+		return l
+	}
+	return value
+}
+
+func (m *rpcMetric) items(result interface{}) []interface{} {
+	if m.each == nil {
+		return []interface{}{result}
+	}
+	var items []interface{}
+	for _, item := range m.each.Select(result) {
+		if l, ok := item.([]interface{}); ok {
+			items = append(items, l...)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func jsonValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return kodi.ParseNumber(v)
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return 0, fmt.Errorf("Invalid value: %v", value)
+}
+
+func jsonLabelValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func (m *rpcMetric) collect(ch chan<- prometheus.Metric, result interface{}, logger log.Logger) {
+	seen := map[string]bool{}
+	for _, item := range m.items(result) {
+		value := float64(1)
+		if m.value != nil {
+			values := m.value.Select(item)
+			if len(values) == 0 {
+				continue
+			}
+			var err error
+			value, err = jsonValue(values[0])
+			if err != nil {
+				logger.Debugf("Can't extract %s: %s", m.value, err)
+				continue
+			}
+		}
+		labelValues := make([]string, len(m.labels))
+		for i, path := range m.labels {
+			if values := path.Select(item); len(values) > 0 {
+				labelValues[i] = jsonLabelValue(values[0])
+			}
+		}
+		// The same series can't be exported twice
+		key := strings.Join(labelValues, "\xff")
+		if seen[key] {
+			logger.Debugf("Duplicated series for %s: %v", m.desc, labelValues)
+			continue
+		}
+		seen[key] = true
+		ch <- prometheus.MustNewConstMetric(
+			m.desc, m.valueType, value, labelValues...,
+		)
+	}
+}
+
+func (e *Exporter) collectRPCMetrics(ch chan<- prometheus.Metric) error {
+	var lastErr error
+	for _, call := range e.rpcMetrics {
+		resp, err := e.client.Call(call.method, call.params)
+		if err != nil || resp.Error != nil {
+			e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+			lastErr = rpcError(err, resp.Error)
+			continue
+		}
+		for _, metric := range call.metrics {
+			metric.collect(ch, resp.Result, e.logger)
+		}
+	}
+	return lastErr
+}
+
+func init() {
+	registerCollector("rpc", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectRPCMetrics)
+	}, "Export the custom metrics from JSONRPC calls.")
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+const rpcMetricsConfig = `
+rpc_metrics:
+  - method: Addons.GetAddons
+    params:
+      properties: [enabled, version]
+      type: xbmc.python.pluginsource
+    metrics:
+      - name: kodi_plugin_addons
+        value: $.addons
+      - name: kodi_plugin_addon_enabled
+        each: $.addons[*]
+        value: $.enabled
+        labels:
+          addonid: $.addonid
+          version: $.version
+`
+
+const addonsResult = `{"addons":[
+  {"addonid":"plugin.video.youtube","enabled":true,"version":"5.3.6"},
+  {"addonid":"plugin.video.vimeo","enabled":false,"version":"4.1.2"},
+  {"addonid":"plugin.video.vimeo","enabled":false,"version":"4.1.2"}
+],"limits":{"end":3,"start":0,"total":3}}`
+
+func TestJSONPath(t *testing.T) {
+	var result interface{}
+	if err := json.Unmarshal([]byte(addonsResult), &result); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for expression, expected := range map[string][]interface{}{
+		"$.limits.total":         {float64(3)},
+		"$['limits']['end']":     {float64(3)},
+		"$.addons[0].addonid":    {"plugin.video.youtube"},
+		"$.addons[-1].version":   {"4.1.2"},
+		"$.addons[*].enabled":    {true, false, false},
+		"$.addons[5].addonid":    nil,
+		"$.unknown":              nil,
+		"$.limits.total.unknown": nil,
+	} {
+		path, err := parseJSONPath(expression)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		values := path.Select(result)
+		if !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Invalid values for %s: %v", expression, values)
+		}
+	}
+	for _, expression := range []string{"", "limits", "$.", "$.addons[", "$.addons[x]"} {
+		if _, err := parseJSONPath(expression); err == nil {
+			t.Fatalf("Invalid path accepted: %s", expression)
+		}
+	}
+}
+
+func TestRPCMetricsCollect(t *testing.T) {
+	filename := writeConfig(t, rpcMetricsConfig)
+	defer os.Remove(filename)
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	calls, err := newRPCMetrics(config.RPCMetrics)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := json.Marshal(calls[0].params); err != nil {
+		t.Fatalf("Can't encode JSONRPC params: %v", err)
+	}
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(addonsResult), &result); err != nil {
+		t.Fatalf("%v", err)
+	}
+	ch := make(chan prometheus.Metric, 10)
+	for _, metric := range calls[0].metrics {
+		metric.collect(ch, result, log.Base())
+	}
+	close(ch)
+
+	var metrics []*dto.Metric
+	for metric := range ch {
+		pb := &dto.Metric{}
+		if err := metric.Write(pb); err != nil {
+			t.Fatalf("%v", err)
+		}
+		metrics = append(metrics, pb)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("Invalid metrics: %v", metrics)
+	}
+	if metrics[0].Gauge.GetValue() != 3 {
+		t.Fatalf("Invalid addons count: %v", metrics[0])
+	}
+	if metrics[1].Gauge.GetValue() != 1 || metrics[1].Label[0].GetValue() != "plugin.video.youtube" {
+		t.Fatalf("Invalid addon metric: %v", metrics[1])
+	}
+	if metrics[2].Gauge.GetValue() != 0 || metrics[2].Label[1].GetValue() != "4.1.2" {
+		t.Fatalf("Invalid addon metric: %v", metrics[2])
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	screenTimeDayLayout = "2006-01-02"
+
+	screenTimeWarning  = "warning"
+	screenTimeExceeded = "exceeded"
+	screenTimeQuiet    = "quiet"
+
+	defaultScreenTimeInterval = time.Minute
+	defaultScreenTimeWarning  = 10 * time.Minute
+)
+
+var (
+	profileWatchToday = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "profile", "watch_seconds_today"),
+		"How long the media were played today by a profile.",
+		labelNames("profile"), nil,
+	)
+	profileBudget = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "profile", "budget_seconds"),
+		"Daily screen time budget of a profile.",
+		labelNames("profile"), nil,
+	)
+)
+
+// quietHours is a period of the day, from Start to End since midnight.
+// The period ends on the next day if End is before Start.
+type quietHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseQuietHours parses a period like "21:00-07:00"
+func parseQuietHours(value string) (*quietHours, error) {
+	clocks := strings.Split(value, "-")
+	if len(clocks) != 2 {
+		return nil, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM", value)
+	}
+	q := &quietHours{}
+	var err error
+	if q.Start, err = parseClock(strings.TrimSpace(clocks[0])); err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %s", value, err)
+	}
+	if q.End, err = parseClock(strings.TrimSpace(clocks[1])); err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %s", value, err)
+	}
+	return q, nil
+}
+
+func (q *quietHours) contains(now time.Time) bool {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	clock := now.Sub(midnight)
+	if q.Start <= q.End {
+		return clock >= q.Start && clock < q.End
+	}
+	return clock >= q.Start || clock < q.End
+}
+
+// screenTimeState is the watch time of the profiles on a day, saved in the
+// state file
+type screenTimeState struct {
+	Day     string             `json:"day"`
+	Watched map[string]float64 `json:"watched_seconds"`
+	Warned  map[string]string  `json:"warned"`
+}
+
+type screenTimeBudget struct {
+	ScreenTimeBudgetConfig
+	quiet *quietHours
+}
+
+// ScreenTimeOptions are the options of a ScreenTime
+type ScreenTimeOptions struct {
+	// Client queries the Kodi server. It is required.
+	Client *kodi.Client
+	// Config is the screen time configuration
+	Config ScreenTimeConfig
+	// Logger defaults to the base logger
+	Logger log.Logger
+}
+
+// ScreenTime tracks the watch time of the Kodi profiles, and enforces their
+// daily budgets: warnings are shown on screen, and the playback could be
+// stopped when the budget is exceeded or during the quiet hours.
+// It implements prometheus.Collector.
+type ScreenTime struct {
+	client   *kodi.Client
+	config   ScreenTimeConfig
+	budgets  map[string]*screenTimeBudget
+	mu       sync.Mutex
+	state    screenTimeState
+	last     time.Time
+	playing  bool
+	profile  string
+	stopChan chan struct{}
+	logger   log.Logger
+}
+
+// NewScreenTime returns the tracker of the screen time budgets. The state
+// of the day is restored from the state file.
+func NewScreenTime(opts ScreenTimeOptions) (*ScreenTime, error) {
+	if opts.Client == nil {
+		return nil, fmt.Errorf("Kodi client not configured")
+	}
+	config := opts.Config
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.Interval == 0 {
+		config.Interval = defaultScreenTimeInterval
+	}
+	if config.Warning == 0 {
+		config.Warning = defaultScreenTimeWarning
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Base()
+	}
+	s := &ScreenTime{
+		client:   opts.Client,
+		logger:   logger,
+		config:   config,
+		budgets:  map[string]*screenTimeBudget{},
+		stopChan: make(chan struct{}),
+	}
+	for _, budget := range config.Budgets {
+		b := &screenTimeBudget{ScreenTimeBudgetConfig: budget}
+		if len(budget.QuietHours) > 0 {
+			b.quiet, _ = parseQuietHours(budget.QuietHours)
+		}
+		s.budgets[budget.Profile] = b
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ScreenTime) load() error {
+	s.state = screenTimeState{Watched: map[string]float64{}, Warned: map[string]string{}}
+	if len(s.config.StateFile) == 0 {
+		return nil
+	}
+	content, err := ioutil.ReadFile(s.config.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Can't read screen time state file: %s", err)
+	}
+	state := screenTimeState{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return fmt.Errorf("Can't decode screen time state file %s: %s", s.config.StateFile, err)
+	}
+	if state.Watched != nil {
+		s.state.Watched = state.Watched
+	}
+	if state.Warned != nil {
+		s.state.Warned = state.Warned
+	}
+	s.state.Day = state.Day
+	return nil
+}
+
+func (s *ScreenTime) save() error {
+	if len(s.config.StateFile) == 0 {
+		return nil
+	}
+	content, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(s.config.StateFile, content)
+}
+
+// Start checks the screen time in background
+func (s *ScreenTime) Start() {
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+		for {
+			s.check(time.Now())
+			select {
+			case <-s.stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the checks
+func (s *ScreenTime) Stop() {
+	close(s.stopChan)
+}
+
+// check updates the watch time of the current profile, and enforces its
+// budget
+func (s *ScreenTime) check(now time.Time) {
+	profileResp, err := s.client.ProfilesGetCurrentProfile()
+	if err != nil || profileResp.Error != nil {
+		s.logger.Errorf("Kodi error : %v %v", err, profileResp.Error)
+		s.interrupt()
+		return
+	}
+	playersResp, err := s.client.PlayerGetActivePlayers()
+	if err != nil || playersResp.Error != nil {
+		s.logger.Errorf("Kodi error : %v %v", err, playersResp.Error)
+		s.interrupt()
+		return
+	}
+	players := []int{}
+	for _, player := range playersResp.Result {
+		if player.Type == "picture" {
+			continue
+		}
+		propertiesResp, err := s.client.PlayerGetProperties(player.PlayerID)
+		if err != nil || propertiesResp.Error != nil {
+			s.logger.Errorf("Kodi error : %v %v", err, propertiesResp.Error)
+			s.interrupt()
+			return
+		}
+		if propertiesResp.Result.Speed != 0 {
+			players = append(players, player.PlayerID)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile := profileResp.Result.Label
+	s.record(now)
+	s.last, s.playing, s.profile = now, len(players) > 0, profile
+	if s.playing {
+		s.enforce(profile, players, now)
+	}
+	if err := s.save(); err != nil {
+		s.logger.Errorf("Can't save screen time state: %s", err)
+	}
+}
+
+// interrupt stops counting the watch time until the next successful check,
+// so the time during which Kodi can't be reached isn't counted
+func (s *ScreenTime) interrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playing = false
+}
+
+// record counts the time elapsed since the previous check if a media was
+// playing, at most the check interval, so the time during which Kodi wasn't
+// checked isn't counted. The watch time is reset every day.
+func (s *ScreenTime) record(now time.Time) {
+	day := now.Format(screenTimeDayLayout)
+	since := s.last
+	if s.state.Day != day {
+		s.state = screenTimeState{Day: day, Watched: map[string]float64{}, Warned: map[string]string{}}
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if since.Before(midnight) {
+			since = midnight
+		}
+	}
+	if s.playing && !s.last.IsZero() && now.After(since) {
+		elapsed := now.Sub(since)
+		if elapsed > s.config.Interval {
+			elapsed = s.config.Interval
+		}
+		s.state.Watched[s.profile] += elapsed.Seconds()
+	}
+}
+
+func (s *ScreenTime) enforce(profile string, players []int, now time.Time) {
+	budget, ok := s.budgets[profile]
+	if !ok {
+		return
+	}
+	watched := time.Duration(s.state.Watched[profile] * float64(time.Second))
+	remaining := budget.Daily - watched
+
+	var level, message string
+	switch {
+	case budget.quiet != nil && budget.quiet.contains(now):
+		level = screenTimeQuiet
+		message = fmt.Sprintf("Quiet hours for %s until %02d:%02d", profile,
+			int(budget.quiet.End.Hours()), int(budget.quiet.End.Minutes())%60)
+	case budget.Daily > 0 && remaining <= 0:
+		level = screenTimeExceeded
+		message = fmt.Sprintf("Daily screen time of %s is over", profile)
+	case budget.Daily > 0 && remaining <= s.config.Warning:
+		level = screenTimeWarning
+		message = fmt.Sprintf("%d minutes of screen time left for %s", int(remaining.Minutes()+0.5), profile)
+	default:
+		return
+	}
+	if s.state.Warned[profile] != level {
+		s.state.Warned[profile] = level
+		s.logger.Infof("Screen time: %s", message)
+		resp, err := s.client.ShowNotification("Screen time", message)
+		if err != nil || resp.Error != nil {
+			s.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+		}
+	}
+	if level != screenTimeWarning && budget.Stop {
+		for _, playerID := range players {
+			s.logger.Infof("Screen time: stopping player %d of %s", playerID, profile)
+			resp, err := s.client.PlayerStop(playerID)
+			if err != nil || resp.Error != nil {
+				s.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+			}
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (s *ScreenTime) Describe(ch chan<- *prometheus.Desc) {
+	ch <- profileWatchToday
+	ch <- profileBudget
+}
+
+// Collect implements prometheus.Collector.
+func (s *ScreenTime) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	watched := map[string]float64{}
+	if s.state.Day == time.Now().Format(screenTimeDayLayout) {
+		watched = s.state.Watched
+	}
+	for profile := range s.budgets {
+		ch <- prometheus.MustNewConstMetric(
+			profileWatchToday, prometheus.GaugeValue, watched[profile], profile,
+		)
+	}
+	for profile, seconds := range watched {
+		if _, ok := s.budgets[profile]; !ok {
+			ch <- prometheus.MustNewConstMetric(
+				profileWatchToday, prometheus.GaugeValue, seconds, profile,
+			)
+		}
+	}
+	for profile, budget := range s.budgets {
+		if budget.Daily > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				profileBudget, prometheus.GaugeValue, budget.Daily.Seconds(), profile,
+			)
+		}
+	}
+}
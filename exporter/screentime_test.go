@@ -0,0 +1,207 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+func TestScreenTimeBudget(t *testing.T) {
+	recorder := &kodiRecorder{responses: map[string]string{
+		"Profiles.GetCurrentProfile": `{"id":1,"jsonrpc":"2.0","result":{"label":"Kids","lockmode":0}}`,
+		"Player.GetActivePlayers":    `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`,
+		"Player.GetProperties":       `{"id":1,"jsonrpc":"2.0","result":{"speed":1}}`,
+	}}
+	h := httptest.NewServer(recorder)
+	defer h.Close()
+	client, err := kodi.NewClient(h.URL, "", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dir, err := ioutil.TempDir("", "kodi_exporter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := ScreenTimeConfig{
+		StateFile: filepath.Join(dir, "screentime.json"),
+		Interval:  15 * time.Minute,
+		Budgets: []ScreenTimeBudgetConfig{
+			{Profile: "Kids", Daily: 30 * time.Minute, QuietHours: "21:00-07:00", Stop: true},
+		},
+	}
+	s, err := NewScreenTime(ScreenTimeOptions{Client: client, Config: config})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	start := time.Date(2016, 7, 10, 17, 0, 0, 0, time.Local)
+	s.check(start)
+	s.check(start.Add(15 * time.Minute))
+	if recorder.called("GUI.ShowNotification") != 0 {
+		t.Fatalf("No warning expected")
+	}
+	s.check(start.Add(25 * time.Minute))
+	if recorder.called("GUI.ShowNotification") != 1 || recorder.called("Player.Stop") != 0 {
+		t.Fatalf("Invalid warning: %v", recorder.calls)
+	}
+	s.check(start.Add(27 * time.Minute))
+	if recorder.called("GUI.ShowNotification") != 1 {
+		t.Fatalf("Warning should be shown once: %v", recorder.calls)
+	}
+	s.check(start.Add(31 * time.Minute))
+	if recorder.called("GUI.ShowNotification") != 2 || recorder.called("Player.Stop") != 1 {
+		t.Fatalf("Playback should be stopped: %v", recorder.calls)
+	}
+	if watched := s.state.Watched["Kids"]; watched != 31*60 {
+		t.Fatalf("Invalid watch time: %f", watched)
+	}
+
+	// The state of the day is restored
+	restarted, err := NewScreenTime(ScreenTimeOptions{Client: client, Config: config})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if watched := restarted.state.Watched["Kids"]; watched != 31*60 {
+		t.Fatalf("Invalid restored watch time: %f", watched)
+	}
+	if warned := restarted.state.Warned["Kids"]; warned != screenTimeExceeded {
+		t.Fatalf("Invalid restored warning: %s", warned)
+	}
+
+	if _, err := NewScreenTime(ScreenTimeOptions{Config: config}); err == nil {
+		t.Fatalf("Screen time without client accepted")
+	}
+
+	// The watch time is reset the next day
+	restarted.check(start.Add(24 * time.Hour))
+	if watched := restarted.state.Watched["Kids"]; watched != 0 {
+		t.Fatalf("Watch time should be reset: %f", watched)
+	}
+}
+
+func TestScreenTimeKodiDown(t *testing.T) {
+	profile := `{"id":1,"jsonrpc":"2.0","result":{"label":"Kids","lockmode":0}}`
+	recorder := &kodiRecorder{responses: map[string]string{
+		"Profiles.GetCurrentProfile": profile,
+		"Player.GetActivePlayers":    `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`,
+		"Player.GetProperties":       `{"id":1,"jsonrpc":"2.0","result":{"speed":1}}`,
+	}}
+	h := httptest.NewServer(recorder)
+	defer h.Close()
+	client, err := kodi.NewClient(h.URL, "", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s, err := NewScreenTime(ScreenTimeOptions{
+		Client: client,
+		Config: ScreenTimeConfig{
+			Interval: 10 * time.Minute,
+			Budgets:  []ScreenTimeBudgetConfig{{Profile: "Kids", Daily: 2 * time.Hour}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	start := time.Date(2016, 7, 10, 17, 0, 0, 0, time.Local)
+	s.check(start)
+	s.check(start.Add(10 * time.Minute))
+	// Kodi is down during 1 hour
+	recorder.respond("Profiles.GetCurrentProfile", `{"error":{"code":-32100,"message":"Failed to execute method."},"id":1,"jsonrpc":"2.0"}`)
+	s.check(start.Add(11 * time.Minute))
+	recorder.respond("Profiles.GetCurrentProfile", profile)
+	s.check(start.Add(70 * time.Minute))
+	s.check(start.Add(75 * time.Minute))
+
+	if watched := s.state.Watched["Kids"]; watched != 15*60 {
+		t.Fatalf("Invalid watch time: %f", watched)
+	}
+
+	// Kodi wasn't checked during 45 minutes: at most the interval is counted
+	s.check(start.Add(120 * time.Minute))
+	if watched := s.state.Watched["Kids"]; watched != 25*60 {
+		t.Fatalf("Invalid watch time after a gap: %f", watched)
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	night, err := parseQuietHours("21:00-07:00")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	afternoon, err := parseQuietHours("13:30-15:00")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for clock, expected := range map[string][2]bool{
+		"06:59": {true, false},
+		"07:00": {false, false},
+		"14:00": {false, true},
+		"15:00": {false, false},
+		"21:00": {true, false},
+		"23:59": {true, false},
+	} {
+		now, _ := time.Parse("15:04", clock)
+		if night.contains(now) != expected[0] || afternoon.contains(now) != expected[1] {
+			t.Fatalf("Invalid quiet hours at %s", clock)
+		}
+	}
+	for _, value := range []string{"21:00", "9pm-7am", "25:00-07:00"} {
+		if _, err := parseQuietHours(value); err == nil {
+			t.Fatalf("Invalid quiet hours accepted: %s", value)
+		}
+	}
+}
+
+func TestLoadScreenTimeConfig(t *testing.T) {
+	filename := writeConfig(t, `
+screen_time:
+  warning: 5m
+  budgets:
+    - profile: Kids
+      daily: 1h30m
+      quiet_hours: 20:30-07:00
+      stop: true
+`)
+	defer os.Remove(filename)
+
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	budgets := config.ScreenTime.Budgets
+	if config.ScreenTime.Warning != 5*time.Minute || len(budgets) != 1 || budgets[0].Daily != 90*time.Minute {
+		t.Fatalf("Invalid screen time: %v", config.ScreenTime)
+	}
+
+	for _, content := range []string{
+		"screen_time:\n  budgets:\n    - profile: Kids\n",
+		"screen_time:\n  budgets:\n    - profile: Kids\n      daily: 1h\n      quiet_hours: 9pm\n",
+		"screen_time:\n  budgets:\n    - daily: 1h\n",
+	} {
+		filename := writeConfig(t, content)
+		defer os.Remove(filename)
+		if _, err := LoadConfig(filename); err == nil {
+			t.Fatalf("Invalid configuration accepted: %s", content)
+		}
+	}
+}
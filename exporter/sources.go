@@ -0,0 +1,263 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+// defaultSourcesTimeout is the timeout of the media sources probes if none
+// is configured
+const defaultSourcesTimeout = 5 * time.Second
+
+var (
+	sourceUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "source", "up"),
+		"Was the last probe of the media source successful.",
+		labelNames("media", "source", "protocol"), nil,
+	)
+	sourceProbeDuration = newLimitedDesc(
+		prometheus.BuildFQName(namespace, "source", "probe_duration_seconds"),
+		"How long the last probe of the media source took.",
+		labelNames("media", "source", "protocol"),
+	)
+
+	libraryItemsBySource = newSummedDesc(
+		prometheus.BuildFQName(namespace, "library", "items_by_source"),
+		"How many library items are stored in a media source.",
+		labelNames("media", "source"), "source",
+	)
+	libraryItemsByProtocol = newSummedDesc(
+		prometheus.BuildFQName(namespace, "library", "items_by_protocol"),
+		"How many library items are accessed using a protocol.",
+		labelNames("media", "protocol"), "protocol",
+	)
+
+	sourcesMedia = []string{"video", "music"}
+
+	schemeRegexp = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*)://`)
+)
+
+// sourceProtocol returns the protocol used to access a Kodi path:
+// smb, nfs, local, plugin, http, ...
+func sourceProtocol(path string) string {
+	match := schemeRegexp.FindStringSubmatch(path)
+	if match == nil {
+		return "local"
+	}
+	switch scheme := strings.ToLower(match[1]); scheme {
+	case "special", "file":
+		return "local"
+	case "https":
+		return "http"
+	default:
+		return scheme
+	}
+}
+
+// sourcePaths returns the paths of a source. A multipath source groups
+// several paths.
+func sourcePaths(source string) []string {
+	if !strings.HasPrefix(source, "multipath://") {
+		return []string{source}
+	}
+	var paths []string
+	for _, path := range strings.Split(strings.TrimPrefix(source, "multipath://"), "/") {
+		if len(path) == 0 {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(path); err == nil {
+			paths = append(paths, decoded)
+		}
+	}
+	return paths
+}
+
+// itemPath returns the path of a library item file. A stacked item is
+// stored with its first file.
+func itemPath(file string) string {
+	if strings.HasPrefix(file, "stack://") {
+		file = strings.TrimPrefix(file, "stack://")
+		if i := strings.Index(file, " , "); i >= 0 {
+			file = file[:i]
+		}
+	}
+	return file
+}
+
+// itemSource returns the label of the source storing a file: the source
+// with the longest matching path
+func itemSource(file string, sources []kodi.Source) string {
+	label := "none"
+	longest := 0
+	for _, source := range sources {
+		for _, path := range sourcePaths(source.File) {
+			if len(path) > longest && strings.HasPrefix(file, path) {
+				label = source.Label
+				longest = len(path)
+			}
+		}
+	}
+	return label
+}
+
+func collectLibraryFiles(ch chan<- prometheus.Metric, media string, files []string, sources []kodi.Source) {
+	bySource := map[string]int{}
+	byProtocol := map[string]int{}
+	for _, file := range files {
+		path := itemPath(file)
+		bySource[itemSource(path, sources)]++
+		byProtocol[sourceProtocol(path)]++
+	}
+	for source, count := range bySource {
+		ch <- prometheus.MustNewConstMetric(
+			libraryItemsBySource, prometheus.GaugeValue, float64(count),
+			media, source,
+		)
+	}
+	for protocol, count := range byProtocol {
+		ch <- prometheus.MustNewConstMetric(
+			libraryItemsByProtocol, prometheus.GaugeValue, float64(count),
+			media, protocol,
+		)
+	}
+}
+
+// getSources returns the media sources, by media
+func (e *Exporter) getSources() (map[string][]kodi.Source, error) {
+	var lastErr error
+	sources := map[string][]kodi.Source{}
+	for _, media := range sourcesMedia {
+		resp, err := e.client.FilesGetSources(media)
+		if err != nil || resp.Error != nil {
+			e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+			lastErr = rpcError(err, resp.Error)
+			continue
+		}
+		sources[media] = resp.Result.Sources
+	}
+	return sources, lastErr
+}
+
+func (e *Exporter) collectLibrarySourcesMetrics(ch chan<- prometheus.Metric) error {
+	sources, lastErr := e.getSources()
+	moviesResp, err := e.client.VideoGetMovies("file")
+	if err != nil || moviesResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, moviesResp.Error)
+		lastErr = rpcError(err, moviesResp.Error)
+	} else {
+		var files []string
+		for _, movie := range moviesResp.Result.Movies {
+			files = append(files, movie.File)
+		}
+		collectLibraryFiles(ch, "movie", files, sources["video"])
+	}
+
+	episodesResp, err := e.client.VideoGetEpisodes("file")
+	if err != nil || episodesResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, episodesResp.Error)
+		lastErr = rpcError(err, episodesResp.Error)
+	} else {
+		var files []string
+		for _, episode := range episodesResp.Result.Episodes {
+			files = append(files, episode.File)
+		}
+		collectLibraryFiles(ch, "episode", files, sources["video"])
+	}
+
+	songsResp, err := e.client.AudioGetSongs("file")
+	if err != nil || songsResp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, songsResp.Error)
+		lastErr = rpcError(err, songsResp.Error)
+	} else {
+		var files []string
+		for _, song := range songsResp.Result.Songs {
+			files = append(files, song.File)
+		}
+		collectLibraryFiles(ch, "song", files, sources["music"])
+	}
+	return lastErr
+}
+
+type sourceProbe struct {
+	media    string
+	source   kodi.Source
+	up       bool
+	duration time.Duration
+}
+
+func (e *Exporter) probeSource(probe *sourceProbe) {
+	client := e.client.WithTimeout(e.sourcesTimeout)
+	start := time.Now()
+	resp, err := client.FilesGetDirectory(probe.source.File, probe.media)
+	probe.duration = time.Since(start)
+	if err != nil || resp.Error != nil {
+		e.logger.Warnf("Media source %s unreachable: %v %v", probe.source.Label, err, resp.Error)
+		return
+	}
+	probe.up = true
+}
+
+func (e *Exporter) collectSourcesMetrics(ch chan<- prometheus.Metric) error {
+	sources, lastErr := e.getSources()
+	var probes []*sourceProbe
+	for _, media := range sourcesMedia {
+		for _, source := range sources[media] {
+			probes = append(probes, &sourceProbe{media: media, source: source})
+		}
+	}
+
+	// Probes run concurrently, so a dead share only delays the scrape by
+	// the probe timeout
+	var wg sync.WaitGroup
+	for _, probe := range probes {
+		wg.Add(1)
+		go func(probe *sourceProbe) {
+			defer wg.Done()
+			e.probeSource(probe)
+		}(probe)
+	}
+	wg.Wait()
+
+	for _, probe := range probes {
+		protocol := sourceProtocol(probe.source.File)
+		ch <- prometheus.MustNewConstMetric(
+			sourceUp, prometheus.GaugeValue, boolToFloat(probe.up),
+			probe.media, probe.source.Label, protocol,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			sourceProbeDuration, prometheus.GaugeValue, probe.duration.Seconds(),
+			probe.media, probe.source.Label, protocol,
+		)
+	}
+	return lastErr
+}
+
+func init() {
+	registerCollector("sources", false, func(e *Exporter) Collector {
+		return collectorFunc(e.collectSourcesMetrics)
+	}, "Probe the video and music sources.")
+	registerCollector("library_sources", false, func(e *Exporter) Collector {
+		return collectorFunc(e.collectLibrarySourcesMetrics)
+	}, "Count the library items stored in each source, and accessed using each protocol.")
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+func TestSourceProtocol(t *testing.T) {
+	for path, expected := range map[string]string{
+		"smb://nas/movies/":                   "smb",
+		"NFS://nas/tvshows/":                  "nfs",
+		"/mnt/media/music/":                   "local",
+		"C:\\Music\\":                         "local",
+		"special://home/videos/":              "local",
+		"plugin://plugin.video.youtube/":      "plugin",
+		"https://example.com/stream.m3u8":     "http",
+		"multipath://smb%3a%2f%2fnas%2fa%2f/": "multipath",
+	} {
+		if protocol := sourceProtocol(path); protocol != expected {
+			t.Fatalf("Invalid protocol for %s: %s", path, protocol)
+		}
+	}
+}
+
+func TestProbeSourceTimeout(t *testing.T) {
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Body)
+		if bytes.Contains(body.Bytes(), []byte("smb://dead/")) {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Write([]byte(`{"id":1,"jsonrpc":"2.0","result":{"files":[],"limits":{"end":0,"start":0,"total":0}}}`))
+	}))
+	defer h.Close()
+	client, err := kodi.NewClient(h.URL, "", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	e := &Exporter{client: client, logger: log.Base(), sourcesTimeout: 100 * time.Millisecond}
+
+	alive := &sourceProbe{media: "video", source: kodi.Source{File: "smb://nas/movies/", Label: "Movies"}}
+	e.probeSource(alive)
+	if !alive.up {
+		t.Fatalf("Source should be up: %v", alive)
+	}
+	dead := &sourceProbe{media: "video", source: kodi.Source{File: "smb://dead/movies/", Label: "Dead"}}
+	e.probeSource(dead)
+	if dead.up || dead.duration > 400*time.Millisecond {
+		t.Fatalf("Source should be down after the timeout: %v", dead)
+	}
+}
+
+func TestDefaultSourcesTimeout(t *testing.T) {
+	e, err := New(Options{Client: newTestClient(t, "http://kodi:8080")})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if e.sourcesTimeout != defaultSourcesTimeout {
+		t.Fatalf("Invalid sources timeout: %s", e.sourcesTimeout)
+	}
+	e, err = New(Options{Client: newTestClient(t, "http://kodi:8080"), SourcesTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if e.sourcesTimeout != time.Second {
+		t.Fatalf("Invalid sources timeout: %s", e.sourcesTimeout)
+	}
+}
+
+func TestItemSource(t *testing.T) {
+	sources := []kodi.Source{
+		{File: "smb://nas/movies/", Label: "Movies"},
+		{File: "smb://nas/movies/kids/", Label: "Kids"},
+		{File: "multipath://nfs%3a%2f%2fnas1%2ftv%2f/nfs%3a%2f%2fnas2%2ftv%2f/", Label: "TV Shows"},
+	}
+	for file, expected := range map[string]string{
+		"smb://nas/movies/Heat.mkv":                                         "Movies",
+		"smb://nas/movies/kids/Aladdin.mkv":                                 "Kids",
+		"nfs://nas2/tv/Deutschland 83/S01E01.mkv":                           "TV Shows",
+		"/home/kodi/Videos/Holidays.mp4":                                    "none",
+		"stack://smb://nas/movies/Heat-1.avi , smb://nas/movies/Heat-2.avi": "Movies",
+	} {
+		if source := itemSource(itemPath(file), sources); source != expected {
+			t.Fatalf("Invalid source for %s: %s", file, source)
+		}
+	}
+}
+
+func TestLibrarySourcesMetrics(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"Files.GetSources":         `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":2,"start":0,"total":2},"sources":[{"file":"smb://nas/movies/","label":"Movies"},{"file":"nfs://nas/tvshows/","label":"TV Shows"}]}}`,
+		"VideoLibrary.GetMovies":   `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":3,"start":0,"total":3},"movies":[{"movieid":1,"file":"smb://nas/movies/Heat.mkv","label":"Heat"},{"movieid":2,"file":"stack://smb://nas/movies/Ran-1.mkv , smb://nas/movies/Ran-2.mkv","label":"Ran"},{"movieid":3,"file":"/media/usb/Alien.mkv","label":"Alien"}]}}`,
+		"VideoLibrary.GetEpisodes": `{"id":1,"jsonrpc":"2.0","result":{"episodes":[{"episodeid":1,"file":"nfs://nas/tvshows/Better Call Saul/S01E01.mkv","label":"1x01. Uno"}],"limits":{"end":1,"start":0,"total":1}}}`,
+	})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectLibrarySourcesMetrics(ch)
+	})
+	// AudioLibrary.GetSongs fails
+	if err == nil {
+		t.Fatalf("The songs error should be returned")
+	}
+	if values := metricValues(t, metrics, libraryItemsBySource); !reflect.DeepEqual(values, map[string]float64{
+		"media=movie,source=Movies":     2,
+		"media=movie,source=none":       1,
+		"media=episode,source=TV Shows": 1,
+	}) {
+		t.Fatalf("Invalid items by source: %v", values)
+	}
+	if values := metricValues(t, metrics, libraryItemsByProtocol); !reflect.DeepEqual(values, map[string]float64{
+		"media=movie,protocol=smb":   2,
+		"media=movie,protocol=local": 1,
+		"media=episode,protocol=nfs": 1,
+	}) {
+		t.Fatalf("Invalid items by protocol: %v", values)
+	}
+}
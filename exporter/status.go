@@ -0,0 +1,143 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+// Paths of the status endpoints
+const (
+	HealthyPath = "/-/healthy"
+	ReadyPath   = "/-/ready"
+	TargetsPath = "/api/v1/targets"
+
+	// ReadyOnProbe: the exporter is ready once Kodi was reached
+	ReadyOnProbe = "probe"
+	// ReadyOnConfig: the exporter is ready once the configuration is loaded,
+	// even if Kodi is switched off
+	ReadyOnConfig = "config"
+)
+
+// readyPolicies are the policies of ReadyHandler
+var readyPolicies = map[string]bool{
+	ReadyOnProbe:  true,
+	ReadyOnConfig: true,
+}
+
+// ValidReadyPolicy checks a policy of ReadyHandler
+func ValidReadyPolicy(policy string) bool {
+	return readyPolicies[policy]
+}
+
+// targetStatus is the status of the queries of a Kodi server
+type targetStatus struct {
+	mu                  sync.Mutex
+	target              string
+	lastScrape          time.Time
+	lastSuccess         time.Time
+	lastError           string
+	consecutiveFailures int
+}
+
+// targetStatusResponse is the status of a target in the targets API
+type targetStatusResponse struct {
+	Target              string     `json:"target"`
+	Up                  bool       `json:"up"`
+	LastScrape          *time.Time `json:"last_scrape,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+func rpcError(err error, respErr *kodi.ResponseError) error {
+	if err != nil {
+		return err
+	}
+	if respErr != nil {
+		return fmt.Errorf("%s [%d]", respErr.Message, respErr.Code)
+	}
+	return nil
+}
+
+// update records the result of a query of Kodi
+func (s *targetStatus) update(err error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastScrape = now
+	if err != nil {
+		s.lastError = err.Error()
+		s.consecutiveFailures++
+		return
+	}
+	s.lastSuccess = now
+	s.lastError = ""
+	s.consecutiveFailures = 0
+}
+
+func (s *targetStatus) reached() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.lastSuccess.IsZero()
+}
+
+func (s *targetStatus) response() targetStatusResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := targetStatusResponse{
+		Target:              s.target,
+		Up:                  !s.lastSuccess.IsZero() && s.consecutiveFailures == 0,
+		LastError:           s.lastError,
+		ConsecutiveFailures: s.consecutiveFailures,
+	}
+	if !s.lastScrape.IsZero() {
+		lastScrape := s.lastScrape
+		resp.LastScrape = &lastScrape
+	}
+	if !s.lastSuccess.IsZero() {
+		lastSuccess := s.lastSuccess
+		resp.LastSuccess = &lastSuccess
+	}
+	return resp
+}
+
+// HealthyHandler answers while the exporter is alive
+func HealthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK\n"))
+}
+
+// ReadyHandler returns the readiness endpoint, using a policy of
+// readyPolicies
+func (e *Exporter) ReadyHandler(policy string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if policy == ReadyOnProbe && !e.status.reached() {
+			http.Error(w, "Kodi not reached yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK\n"))
+	}
+}
+
+// TargetsHandler returns the status of the Kodi servers as JSON
+func (e *Exporter) TargetsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"targets": []targetStatusResponse{e.status.response()},
+	})
+}
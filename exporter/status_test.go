@@ -0,0 +1,81 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadyHandler(t *testing.T) {
+	h := newKodiServer(`{"id":1,"jsonrpc":"2.0","result":"pong"}`)
+	defer h.Close()
+	e, err := New(Options{Client: newTestClient(t, h.URL)})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for policy, status := range map[string]int{
+		ReadyOnProbe:  http.StatusServiceUnavailable,
+		ReadyOnConfig: http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		e.ReadyHandler(policy)(w, httptest.NewRequest("GET", ReadyPath, nil))
+		if w.Code != status {
+			t.Fatalf("Invalid status with policy %s: %d", policy, w.Code)
+		}
+	}
+
+	e.connect(time.Millisecond, false)
+	w := httptest.NewRecorder()
+	e.ReadyHandler(ReadyOnProbe)(w, httptest.NewRequest("GET", ReadyPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Exporter should be ready once Kodi was reached: %d", w.Code)
+	}
+}
+
+func TestTargetsHandler(t *testing.T) {
+	e, err := New(Options{Client: newTestClient(t, "http://kodi:8080")})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	now := time.Now()
+	e.status.update(nil, now.Add(-time.Minute))
+	e.status.update(fmt.Errorf("connection refused"), now.Add(-30*time.Second))
+	e.status.update(fmt.Errorf("connection refused"), now)
+
+	w := httptest.NewRecorder()
+	e.TargetsHandler(w, httptest.NewRequest("GET", TargetsPath, nil))
+	resp := struct {
+		Targets []targetStatusResponse `json:"targets"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(resp.Targets) != 1 {
+		t.Fatalf("Invalid targets: %s", w.Body.String())
+	}
+	target := resp.Targets[0]
+	if target.Target != "http://kodi:8080" || target.Up || target.ConsecutiveFailures != 2 || target.LastError != "connection refused" {
+		t.Fatalf("Invalid target status: %s", w.Body.String())
+	}
+	if target.LastScrape == nil || !target.LastScrape.Equal(now) || target.LastSuccess == nil {
+		t.Fatalf("Invalid target times: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	totalSpaceLabel = "System.TotalSpace"
+	freeSpaceLabel  = "System.FreeSpace"
+	usedSpaceLabel  = "System.UsedSpace"
+)
+
+var (
+	storageTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "storage", "total_bytes"),
+		"Size of the storage used by Kodi.",
+		nil, nil,
+	)
+	storageFree = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "storage", "free_bytes"),
+		"Free space on the storage used by Kodi.",
+		nil, nil,
+	)
+	storageUsed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "storage", "used_bytes"),
+		"Used space on the storage used by Kodi.",
+		nil, nil,
+	)
+
+	storageLabels = []string{
+		totalSpaceLabel,
+		freeSpaceLabel,
+		usedSpaceLabel,
+	}
+)
+
+func (e *Exporter) collectStorageMetrics(ch chan<- prometheus.Metric) error {
+	resp, err := e.client.GetInfoLabels(storageLabels)
+	if err != nil || resp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+		return rpcError(err, resp.Error)
+	}
+	for _, metric := range []struct {
+		desc  *prometheus.Desc
+		label string
+	}{
+		{storageTotal, totalSpaceLabel},
+		{storageFree, freeSpaceLabel},
+		{storageUsed, usedSpaceLabel},
+	} {
+		value, err := kodi.ParseBytes(resp.Result[metric.label])
+		if err != nil {
+			e.logger.Debugf("Can't parse %s: %s", metric.label, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metric.desc, prometheus.GaugeValue, value,
+		)
+	}
+	return nil
+}
+
+func init() {
+	registerCollector("storage", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectStorageMetrics)
+	}, "Export the storage metrics.")
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func TestStorageMetrics(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"XBMC.GetInfoLabels": `{"id":1,"jsonrpc":"2.0","result":{"System.FreeSpace":"1,234.5 MB free","System.TotalSpace":"28,70 GB Total","System.UsedSpace":"Unavailable"}}`,
+	})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectStorageMetrics(ch)
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for desc, expected := range map[*prometheus.Desc]map[string]float64{
+		storageTotal: {"": 28.7 * (1 << 30)},
+		storageFree:  {"": 1234.5 * (1 << 20)},
+		storageUsed:  {},
+	} {
+		if values := metricValues(t, metrics, desc); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Invalid values of %s: %v", desc, values)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/nlamirault/kodi_exporter/kodi"
+)
+
+const (
+	cpuUsageLabel       = "System.CpuUsage"
+	memoryUsedLabel     = "System.Memory(used.percent)"
+	cpuTemperatureLabel = "System.CPUTemperature"
+	gpuTemperatureLabel = "System.GPUTemperature"
+	uptimeLabel         = "System.Uptime"
+	totalUptimeLabel    = "System.TotalUptime"
+	fpsLabel            = "System.FPS"
+)
+
+var (
+	cpuUsage = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "system", "cpu_usage_ratio"),
+		"CPU usage of the Kodi system, averaged over all cores.",
+		nil, nil,
+	)
+	memoryUsed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "system", "memory_used_ratio"),
+		"Memory used by the Kodi system.",
+		nil, nil,
+	)
+	cpuTemperature = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "system", "cpu_temperature_celsius"),
+		"CPU temperature of the Kodi system.",
+		nil, nil,
+	)
+	gpuTemperature = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "system", "gpu_temperature_celsius"),
+		"GPU temperature of the Kodi system.",
+		nil, nil,
+	)
+	uptime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "system", "uptime_seconds"),
+		"How long Kodi has been running.",
+		nil, nil,
+	)
+	totalUptime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "system", "total_uptime_seconds"),
+		"How long Kodi has been running since its installation.",
+		nil, nil,
+	)
+	fps = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "system", "fps"),
+		"Frames per second rendered by Kodi.",
+		nil, nil,
+	)
+
+	systemLabels = []string{
+		cpuUsageLabel,
+		memoryUsedLabel,
+		cpuTemperatureLabel,
+		gpuTemperatureLabel,
+		uptimeLabel,
+		totalUptimeLabel,
+		fpsLabel,
+	}
+)
+
+type infoLabelParser func(string) (float64, error)
+
+func parseRatio(value string) (float64, error) {
+	percent, err := kodi.ParsePercent(value)
+	if err != nil {
+		return 0, err
+	}
+	return percent / 100, nil
+}
+
+func parseSeconds(value string) (float64, error) {
+	duration, err := kodi.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return duration.Seconds(), nil
+}
+
+func (e *Exporter) collectSystemMetrics(ch chan<- prometheus.Metric) error {
+	resp, err := e.client.GetInfoLabels(systemLabels)
+	if err != nil || resp.Error != nil {
+		e.logger.Errorf("Kodi error : %v %v", err, resp.Error)
+		return rpcError(err, resp.Error)
+	}
+	for _, metric := range []struct {
+		desc   *prometheus.Desc
+		label  string
+		parser infoLabelParser
+	}{
+		{cpuUsage, cpuUsageLabel, parseRatio},
+		{memoryUsed, memoryUsedLabel, parseRatio},
+		{cpuTemperature, cpuTemperatureLabel, kodi.ParseTemperature},
+		{gpuTemperature, gpuTemperatureLabel, kodi.ParseTemperature},
+		{uptime, uptimeLabel, parseSeconds},
+		{totalUptime, totalUptimeLabel, parseSeconds},
+		{fps, fpsLabel, kodi.ParseNumber},
+	} {
+		value, err := metric.parser(resp.Result[metric.label])
+		if err != nil {
+			// Some labels are not available on every platform
+			e.logger.Debugf("Can't parse %s: %s", metric.label, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metric.desc, prometheus.GaugeValue, value,
+		)
+	}
+	return nil
+}
+
+func init() {
+	registerCollector("system", true, func(e *Exporter) Collector {
+		return collectorFunc(e.collectSystemMetrics)
+	}, "Export the system metrics.")
+}
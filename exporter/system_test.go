@@ -0,0 +1,67 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func TestSystemMetrics(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{
+		"XBMC.GetInfoLabels": `{"id":1,"jsonrpc":"2.0","result":{"System.CPUTemperature":"52°C","System.CpuUsage":"CPU0: 12% CPU1: 4%","System.FPS":"59.94 fps","System.GPUTemperature":"Busy","System.Memory(used.percent)":"25%","System.TotalUptime":"2 weeks","System.Uptime":"5 minutes"}}`,
+	})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectSystemMetrics(ch)
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for desc, expected := range map[*prometheus.Desc]map[string]float64{
+		cpuUsage:       {"": 0.08},
+		memoryUsed:     {"": 0.25},
+		cpuTemperature: {"": 52},
+		uptime:         {"": 300},
+		totalUptime:    {"": 14 * 24 * 3600},
+		fps:            {"": 59.94},
+		// Not available yet
+		gpuTemperature: {},
+	} {
+		if values := metricValues(t, metrics, desc); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Invalid values of %s: %v", desc, values)
+		}
+	}
+}
+
+func TestSystemMetricsKodiError(t *testing.T) {
+	h, client := newKodiRPCServer(t, map[string]string{})
+	defer h.Close()
+	e := &Exporter{client: client, logger: log.Base()}
+
+	var err error
+	metrics := gather(func(ch chan<- prometheus.Metric) {
+		err = e.collectSystemMetrics(ch)
+	})
+	if err == nil || len(metrics) != 0 {
+		t.Fatalf("Kodi error expected: %v %v", err, metrics)
+	}
+}
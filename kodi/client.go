@@ -21,6 +21,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/prometheus/common/log"
 )
@@ -48,6 +50,25 @@ func NewClient(address string, username string, password string) (*Client, error
 
 }
 
+// Address returns the address of the Kodi server, as given to NewClient
+func (k *Client) Address() string {
+	return strings.TrimSuffix(k.URI, "/jsonrpc")
+}
+
+// WithTimeout returns a copy of the client whose requests fail after the
+// given timeout
+func (k *Client) WithTimeout(timeout time.Duration) *Client {
+	return &Client{
+		URI:      k.URI,
+		Username: k.Username,
+		Password: k.Password,
+		Client: &http.Client{
+			Transport: k.Client.Transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
 func (k *Client) performRequest(request *Request) (*http.Response, error) {
 	body, err := json.Marshal(request)
 	if err != nil {
@@ -75,6 +96,7 @@ func (k *Client) rpc(method string, params interface{}, response interface{}) er
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("Can't read response body: %s", err)
@@ -89,6 +111,23 @@ func (k *Client) rpc(method string, params interface{}, response interface{}) er
 	return nil
 }
 
+// Call make a RPC call to any method of the Kodi API. The result is
+// decoded as generic JSON values.
+func (k *Client) Call(method string, params interface{}) (*CallResponse, error) {
+	log.Debugf("Kodi %s API", method)
+	resp := &CallResponse{}
+	err := k.rpc(method, params, resp)
+	return resp, err
+}
+
+func listParams(properties []string) map[string]interface{} {
+	params := map[string]interface{}{}
+	if len(properties) > 0 {
+		params[`properties`] = properties
+	}
+	return params
+}
+
 // Ping make a RPC call to the Ping responsder
 func (k *Client) Ping() (*PingResponse, error) {
 	log.Debugf("Kodi Ping API")
@@ -109,6 +148,124 @@ func (k *Client) ShowNotification(title string, message string) (*ShowNotificati
 	return resp, err
 }
 
+// ShowNotificationWithImage make a RPC call to shows a GUI notification with
+// an image ("info", "warning", "error" or an image path), during displaytime
+// milliseconds
+func (k *Client) ShowNotificationWithImage(title string, message string, image string, displaytime int) (*ShowNotificationResponse, error) {
+	log.Debugf("Kodi GUI.ShowNotification API: %s %s %s", title, message, image)
+	resp := &ShowNotificationResponse{}
+	params := map[string]interface{}{
+		`title`:   title,
+		`message`: message,
+	}
+	if len(image) > 0 {
+		params[`image`] = image
+	}
+	if displaytime > 0 {
+		params[`displaytime`] = displaytime
+	}
+	err := k.rpc("GUI.ShowNotification", params, resp)
+	return resp, err
+}
+
+// GetInfoLabels make a RPC call to retrieve the values of some InfoLabels
+func (k *Client) GetInfoLabels(labels []string) (*GetInfoLabelsResponse, error) {
+	resp := &GetInfoLabelsResponse{}
+	params := map[string]interface{}{
+		`labels`: labels,
+	}
+	err := k.rpc("XBMC.GetInfoLabels", params, resp)
+	return resp, err
+}
+
+// GetInfoBooleans make a RPC call to retrieve the values of some InfoBooleans
+func (k *Client) GetInfoBooleans(booleans []string) (*GetInfoBooleansResponse, error) {
+	resp := &GetInfoBooleansResponse{}
+	params := map[string]interface{}{
+		`booleans`: booleans,
+	}
+	err := k.rpc("XBMC.GetInfoBooleans", params, resp)
+	return resp, err
+}
+
+// PlayerGetActivePlayers make a RPC call to retrieve the active players
+func (k *Client) PlayerGetActivePlayers() (*PlayerGetActivePlayersResponse, error) {
+	resp := &PlayerGetActivePlayersResponse{}
+	params := map[string]interface{}{}
+	err := k.rpc("Player.GetActivePlayers", params, resp)
+	return resp, err
+}
+
+// PlayerGetItem make a RPC call to retrieve the item played by a player
+func (k *Client) PlayerGetItem(playerid int) (*PlayerGetItemResponse, error) {
+	resp := &PlayerGetItemResponse{}
+	params := map[string]interface{}{
+		`playerid`:   playerid,
+		`properties`: []string{`title`, `showtitle`, `channel`, `channeltype`},
+	}
+	err := k.rpc("Player.GetItem", params, resp)
+	return resp, err
+}
+
+// PlayerGetProperties make a RPC call to retrieve the state of a player
+func (k *Client) PlayerGetProperties(playerid int) (*PlayerGetPropertiesResponse, error) {
+	resp := &PlayerGetPropertiesResponse{}
+	params := map[string]interface{}{
+		`playerid`:   playerid,
+		`properties`: []string{`speed`},
+	}
+	err := k.rpc("Player.GetProperties", params, resp)
+	return resp, err
+}
+
+// PlayerStop make a RPC call to stop a player
+func (k *Client) PlayerStop(playerid int) (*ActionResponse, error) {
+	resp := &ActionResponse{}
+	params := map[string]interface{}{
+		`playerid`: playerid,
+	}
+	err := k.rpc("Player.Stop", params, resp)
+	return resp, err
+}
+
+// ProfilesGetCurrentProfile make a RPC call to retrieve the current profile
+func (k *Client) ProfilesGetCurrentProfile() (*ProfilesGetCurrentProfileResponse, error) {
+	resp := &ProfilesGetCurrentProfileResponse{}
+	params := map[string]interface{}{}
+	err := k.rpc("Profiles.GetCurrentProfile", params, resp)
+	return resp, err
+}
+
+// AudioScan make a RPC call to scan the sources for new songs
+func (k *Client) AudioScan() (*ActionResponse, error) {
+	resp := &ActionResponse{}
+	err := k.rpc("AudioLibrary.Scan", map[string]interface{}{}, resp)
+	return resp, err
+}
+
+// AudioClean make a RPC call to clean the audio library from non-existent
+// items
+func (k *Client) AudioClean() (*ActionResponse, error) {
+	resp := &ActionResponse{}
+	err := k.rpc("AudioLibrary.Clean", map[string]interface{}{}, resp)
+	return resp, err
+}
+
+// VideoScan make a RPC call to scan the sources for new videos
+func (k *Client) VideoScan() (*ActionResponse, error) {
+	resp := &ActionResponse{}
+	err := k.rpc("VideoLibrary.Scan", map[string]interface{}{}, resp)
+	return resp, err
+}
+
+// VideoClean make a RPC call to clean the video library from non-existent
+// items
+func (k *Client) VideoClean() (*ActionResponse, error) {
+	resp := &ActionResponse{}
+	err := k.rpc("VideoLibrary.Clean", map[string]interface{}{}, resp)
+	return resp, err
+}
+
 // AudioGetArtists make a RPC call to retrieve all artists
 func (k *Client) AudioGetArtists() (*AudioGetArtistsResponse, error) {
 	resp := &AudioGetArtistsResponse{}
@@ -125,22 +282,33 @@ func (k *Client) AudioGetAlbums() (*AudioGetAlbumsResponse, error) {
 	return resp, err
 }
 
-// AudioGetSongs make a RPC call to retrieve all songs
-func (k *Client) AudioGetSongs() (*AudioGetSongsResponse, error) {
+// AudioGetSongs make a RPC call to retrieve all songs, with some optional
+// properties
+func (k *Client) AudioGetSongs(properties ...string) (*AudioGetSongsResponse, error) {
 	resp := &AudioGetSongsResponse{}
-	params := map[string]interface{}{}
+	params := listParams(properties)
 	err := k.rpc("AudioLibrary.GetSongs", params, resp)
 	return resp, err
 }
 
-// VideoGetMovies make a RPC call to retrieve all movies
-func (k *Client) VideoGetMovies() (*VideoGetMoviesResponse, error) {
+// VideoGetMovies make a RPC call to retrieve all movies, with some optional
+// properties
+func (k *Client) VideoGetMovies(properties ...string) (*VideoGetMoviesResponse, error) {
 	resp := &VideoGetMoviesResponse{}
-	params := map[string]interface{}{}
+	params := listParams(properties)
 	err := k.rpc("VideoLibrary.GetMovies", params, resp)
 	return resp, err
 }
 
+// VideoGetEpisodes make a RPC call to retrieve all episodes, with some
+// optional properties
+func (k *Client) VideoGetEpisodes(properties ...string) (*VideoGetEpisodesResponse, error) {
+	resp := &VideoGetEpisodesResponse{}
+	params := listParams(properties)
+	err := k.rpc("VideoLibrary.GetEpisodes", params, resp)
+	return resp, err
+}
+
 // VideoGetTVShows make a RPC call to retrieve all TV shows
 func (k *Client) VideoGetTVShows() (*VideoGetTVShowsResponse, error) {
 	resp := &VideoGetTVShowsResponse{}
@@ -167,3 +335,117 @@ func (k *Client) VideoGetTVShowsGenres() (*VideoGetGenresResponse, error) {
 func (k *Client) VideoGetMoviesGenres() (*VideoGetGenresResponse, error) {
 	return k.videoGetGenres("movie")
 }
+
+// AddonsGetAddons make a RPC call to retrieve all installed add-ons
+func (k *Client) AddonsGetAddons() (*AddonsGetAddonsResponse, error) {
+	resp := &AddonsGetAddonsResponse{}
+	params := map[string]interface{}{
+		`enabled`:    `all`,
+		`properties`: []string{`name`, `version`, `enabled`, `installed`, `broken`},
+	}
+	err := k.rpc("Addons.GetAddons", params, resp)
+	return resp, err
+}
+
+// PVRGetProperties make a RPC call to retrieve the state of the PVR
+func (k *Client) PVRGetProperties() (*PVRGetPropertiesResponse, error) {
+	resp := &PVRGetPropertiesResponse{}
+	params := map[string]interface{}{
+		`properties`: []string{`available`, `recording`, `scanning`},
+	}
+	err := k.rpc("PVR.GetProperties", params, resp)
+	return resp, err
+}
+
+// PVRGetChannelGroups make a RPC call to retrieve the channel groups of
+// a type of channels: tv or radio
+func (k *Client) PVRGetChannelGroups(channeltype string) (*PVRGetChannelGroupsResponse, error) {
+	resp := &PVRGetChannelGroupsResponse{}
+	params := map[string]interface{}{
+		`channeltype`: channeltype,
+	}
+	err := k.rpc("PVR.GetChannelGroups", params, resp)
+	return resp, err
+}
+
+func (k *Client) pvrGetChannels(channelgroupid string) (*PVRGetChannelsResponse, error) {
+	resp := &PVRGetChannelsResponse{}
+	params := map[string]interface{}{
+		`channelgroupid`: channelgroupid,
+	}
+	err := k.rpc("PVR.GetChannels", params, resp)
+	return resp, err
+}
+
+// PVRGetTVChannels make a RPC call to retrieve all TV channels
+func (k *Client) PVRGetTVChannels() (*PVRGetChannelsResponse, error) {
+	return k.pvrGetChannels("alltv")
+}
+
+// PVRGetRadioChannels make a RPC call to retrieve all radio channels
+func (k *Client) PVRGetRadioChannels() (*PVRGetChannelsResponse, error) {
+	return k.pvrGetChannels("allradio")
+}
+
+// PVRGetRecordings make a RPC call to retrieve all recordings
+func (k *Client) PVRGetRecordings() (*PVRGetRecordingsResponse, error) {
+	resp := &PVRGetRecordingsResponse{}
+	params := map[string]interface{}{}
+	err := k.rpc("PVR.GetRecordings", params, resp)
+	return resp, err
+}
+
+// PVRGetTimers make a RPC call to retrieve all timers
+func (k *Client) PVRGetTimers() (*PVRGetTimersResponse, error) {
+	resp := &PVRGetTimersResponse{}
+	params := map[string]interface{}{
+		`properties`: []string{`state`},
+	}
+	err := k.rpc("PVR.GetTimers", params, resp)
+	return resp, err
+}
+
+// PVRGetChannelDetails make a RPC call to retrieve the details of a channel,
+// with the current and next broadcasts
+func (k *Client) PVRGetChannelDetails(channelid int) (*PVRGetChannelDetailsResponse, error) {
+	resp := &PVRGetChannelDetailsResponse{}
+	params := map[string]interface{}{
+		`channelid`:  channelid,
+		`properties`: []string{`channeltype`, `broadcastnow`, `broadcastnext`},
+	}
+	err := k.rpc("PVR.GetChannelDetails", params, resp)
+	return resp, err
+}
+
+// PVRGetBroadcasts make a RPC call to retrieve the EPG of a channel
+func (k *Client) PVRGetBroadcasts(channelid int) (*PVRGetBroadcastsResponse, error) {
+	resp := &PVRGetBroadcastsResponse{}
+	params := map[string]interface{}{
+		`channelid`:  channelid,
+		`properties`: []string{`title`, `starttime`, `endtime`, `genre`},
+	}
+	err := k.rpc("PVR.GetBroadcasts", params, resp)
+	return resp, err
+}
+
+// FilesGetSources make a RPC call to retrieve the sources of a media type:
+// video, music, pictures, files or programs
+func (k *Client) FilesGetSources(media string) (*FilesGetSourcesResponse, error) {
+	resp := &FilesGetSourcesResponse{}
+	params := map[string]interface{}{
+		`media`: media,
+	}
+	err := k.rpc("Files.GetSources", params, resp)
+	return resp, err
+}
+
+// FilesGetDirectory make a RPC call to retrieve the content of a directory
+func (k *Client) FilesGetDirectory(directory string, media string) (*FilesGetDirectoryResponse, error) {
+	resp := &FilesGetDirectoryResponse{}
+	params := map[string]interface{}{
+		`directory`: directory,
+		`media`:     media,
+	}
+	err := k.rpc("Files.GetDirectory", params, resp)
+	return resp, err
+}
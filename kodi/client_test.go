@@ -22,6 +22,7 @@ import (
 	"net/http/httptest"
 	// "net/http/httputil"
 	"testing"
+	"time"
 
 	"github.com/prometheus/common/log"
 )
@@ -44,6 +45,9 @@ func Test_CanCreateKodiClientWithAuthentication(t *testing.T) {
 	if client.URI != "http://localhost:8080/jsonrpc" {
 		t.Fatalf("Kodi invalud JSONRPC Uri: %s", client.URI)
 	}
+	if client.Address() != "http://localhost:8080" {
+		t.Fatalf("Kodi invalid address: %s", client.Address())
+	}
 }
 
 type kodiserver struct {
@@ -70,12 +74,48 @@ func handler(ks *kodiserver, req *Request) http.HandlerFunc {
 		switch req.Method {
 		case "JSONRPC.Ping":
 			resp = `{"id":1,"jsonrpc":"2.0","result":"pong"}`
-		case "GUI.ShowNotification":
+		case "GUI.ShowNotification", "Player.Stop", "VideoLibrary.Scan", "VideoLibrary.Clean", "AudioLibrary.Scan", "AudioLibrary.Clean":
 			resp = `{"id":1,"jsonrpc":"2.0","result":"OK"}`
+		case "Addons.GetAddons":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"addons":[{"addonid":"plugin.video.youtube","broken":false,"enabled":true,"installed":true,"name":"YouTube","type":"xbmc.python.pluginsource","version":"5.3.6"},{"addonid":"script.old","broken":"Not compatible","enabled":false,"installed":true,"name":"Old","type":"xbmc.python.script","version":"1.0.0"}],"limits":{"end":2,"start":0,"total":2}}}`
+		case "PVR.GetProperties":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"available":true,"recording":true,"scanning":false}}`
+		case "PVR.GetChannelGroups":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"channelgroups":[{"channelgroupid":1,"channeltype":"tv","label":"All channels"},{"channelgroupid":3,"channeltype":"tv","label":"Favourites"}],"limits":{"end":2,"start":0,"total":2}}}`
+		case "PVR.GetChannels":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"channels":[{"channelid":1,"label":"France 2"},{"channelid":2,"label":"Arte"},{"channelid":3,"label":"France 5"}],"limits":{"end":3,"start":0,"total":3}}}`
+		case "PVR.GetRecordings":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":1,"start":0,"total":1},"recordings":[{"label":"Le journal","recordingid":1}]}}`
+		case "PVR.GetTimers":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":2,"start":0,"total":2},"timers":[{"label":"Le journal","state":"recording","timerid":1},{"label":"Arte Reportage","state":"scheduled","timerid":2}]}}`
+		case "PVR.GetChannelDetails":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"channeldetails":{"broadcastnext":{"broadcastid":12,"genre":["News"],"label":"Météo","title":"Météo"},"broadcastnow":{"broadcastid":11,"endtime":"2016-07-10 18:30:00","genre":["News","Magazine"],"label":"Le journal","progresspercentage":42.5,"starttime":"2016-07-10 18:00:00","title":"Le journal"},"channelid":1,"channeltype":"tv","label":"France 2"}}}`
+		case "PVR.GetBroadcasts":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"broadcasts":[{"broadcastid":11,"endtime":"2016-07-10 18:30:00","genre":["News"],"label":"Le journal","starttime":"2016-07-10 18:00:00","title":"Le journal"},{"broadcastid":12,"endtime":"2016-07-10 18:35:00","genre":["News"],"label":"Météo","starttime":"2016-07-10 18:30:00","title":"Météo"}],"limits":{"end":2,"start":0,"total":2}}}`
+		case "Player.GetActivePlayers":
+			resp = `{"id":1,"jsonrpc":"2.0","result":[{"playerid":1,"type":"video"}]}`
+		case "Player.GetItem":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"item":{"channel":"France 2","channeltype":"tv","id":1,"label":"France 2","title":"Le journal","type":"channel"}}}`
+		case "Player.GetProperties":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"speed":1}}`
+		case "Profiles.GetCurrentProfile":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"label":"Kids","lockmode":0}}`
+		case "Files.GetSources":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":2,"start":0,"total":2},"sources":[{"file":"smb://nas/movies/","label":"Movies"},{"file":"nfs://nas/tvshows/","label":"TV Shows"}]}}`
+		case "Files.GetDirectory":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"files":[{"file":"smb://nas/movies/Aladdin.mkv","filetype":"file","label":"Aladdin.mkv","type":"unknown"}],"limits":{"end":1,"start":0,"total":1}}}`
+		case "Settings.GetSettingValue":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"value":true}}`
+		case "XBMC.GetInfoLabels":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"System.CPUTemperature":"52°C","System.CpuUsage":"CPU0: 12% CPU1: 4%","System.Uptime":"3 days, 4 hours, 12 minutes"}}`
+		case "XBMC.GetInfoBooleans":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"Library.IsScanning":false,"System.ScreenSaverActive":true}}`
 		case "VideoLibrary.GetMovies":
 			resp = `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":3,"start":0,"total":3},"movies":[{"label":"108 Rois-Démons","movieid":1},{"label":"1001 pattes","movieid":2},{"label":"Aladdin","movieid":3}]}}`
 		case "VideoLibrary.GetTVShows":
 			resp = `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":4,"start":0,"total":4},"tvshows":[{"label":"Better Call Saul","tvshowid":1},{"label":"Star Wars - The Clone Wars","tvshowid":2},{"label":"Star Wars Rebels","tvshowid":3},{"label":"Deutschland 83","tvshowid":4}]}}`
+		case "VideoLibrary.GetEpisodes":
+			resp = `{"id":1,"jsonrpc":"2.0","result":{"episodes":[{"episodeid":1,"file":"nfs://nas/tvshows/Better Call Saul/S01E01.mkv","label":"1x01. Uno"},{"episodeid":2,"file":"nfs://nas/tvshows/Better Call Saul/S01E02.mkv","label":"1x02. Mijo"}],"limits":{"end":2,"start":0,"total":2}}}`
 		case "AudioLibrary.GetSongs":
 			resp = `{"id":1,"jsonrpc":"2.0","result":{"limits":{"end":3095,"start":0,"total":3095},"songs":[{"label":"When the Going Gets Tough, the Tough Get Karazzee","songid":1},{"label":"Pardon My Freedom","songid":2},{"label":"Dear Can","songid":3},{"label":"King's Weed","songid":4}],"limits":{"end":4,"start":0,"total":4}}}`
 		case "AudioLibrary.GetArtists":
@@ -117,6 +157,21 @@ func TestKodiShowNotificationCall(t *testing.T) {
 	}
 }
 
+func TestKodiShowNotificationWithImageCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.ShowNotificationWithImage("unit", "test", "warning", 10000)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result != "OK" {
+		t.Fatalf("Invalid GUI ShowNotification response: %v", resp)
+	}
+}
+
 func TestKodiPingCall(t *testing.T) {
 	req := &Request{}
 	h, client := getClientAndServer(t, req)
@@ -180,6 +235,25 @@ func TestKodiGetTVShowsCall(t *testing.T) {
 	}
 }
 
+func TestKodiGetEpisodesCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.VideoGetEpisodes("file")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Limits.Total != 2 || resp.Result.Episodes[1].File != "nfs://nas/tvshows/Better Call Saul/S01E02.mkv" {
+		t.Fatalf("Invalid episodes: %v", resp)
+	}
+	params, ok := req.Params.(map[string]interface{})
+	if !ok || params["properties"] == nil {
+		t.Fatalf("Invalid episodes request: %v", req)
+	}
+}
+
 func TestKodiGetArtistsCall(t *testing.T) {
 	req := &Request{}
 	h, client := getClientAndServer(t, req)
@@ -224,3 +298,301 @@ func TestKodiGetSongsCall(t *testing.T) {
 		t.Fatalf("Invalid songs end: %s", resp)
 	}
 }
+
+func TestKodiCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.Call("Settings.GetSettingValue", map[string]interface{}{
+		"setting": "videoplayer.adjustrefreshrate",
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok || result["value"] != true {
+		t.Fatalf("Invalid call response: %v", resp)
+	}
+}
+
+func TestKodiGetInfoLabelsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.GetInfoLabels([]string{"System.CPUTemperature", "System.CpuUsage", "System.Uptime"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if len(resp.Result) != 3 || resp.Result["System.CPUTemperature"] != "52°C" {
+		t.Fatalf("Invalid info labels: %v", resp)
+	}
+}
+
+func TestKodiGetInfoBooleansCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.GetInfoBooleans([]string{"Library.IsScanning", "System.ScreenSaverActive"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result["Library.IsScanning"] || !resp.Result["System.ScreenSaverActive"] {
+		t.Fatalf("Invalid info booleans: %v", resp)
+	}
+}
+
+func TestKodiGetAddonsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.AddonsGetAddons()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Limits.Total != 2 || len(resp.Result.Addons) != 2 {
+		t.Fatalf("Invalid addons: %v", resp)
+	}
+	if resp.Result.Addons[0].IsBroken() || !resp.Result.Addons[1].IsBroken() {
+		t.Fatalf("Invalid broken addons: %v", resp)
+	}
+}
+
+func TestKodiPVRGetPropertiesCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PVRGetProperties()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if !resp.Result.Available || !resp.Result.Recording || resp.Result.Scanning {
+		t.Fatalf("Invalid PVR properties: %v", resp)
+	}
+}
+
+func TestKodiPVRGetChannelGroupsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PVRGetChannelGroups("tv")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Limits.Total != 2 || resp.Result.ChannelGroups[1].Label != "Favourites" {
+		t.Fatalf("Invalid channel groups: %v", resp)
+	}
+}
+
+func TestKodiPVRGetChannelsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PVRGetTVChannels()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Limits.Total != 3 {
+		t.Fatalf("Invalid channels: %v", resp)
+	}
+}
+
+func TestKodiPVRGetRecordingsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PVRGetRecordings()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Limits.Total != 1 {
+		t.Fatalf("Invalid recordings: %v", resp)
+	}
+}
+
+func TestKodiPVRGetTimersCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PVRGetTimers()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if len(resp.Result.Timers) != 2 || resp.Result.Timers[0].State != "recording" {
+		t.Fatalf("Invalid timers: %v", resp)
+	}
+}
+
+func TestKodiPlayerGetActivePlayersCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PlayerGetActivePlayers()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if len(resp.Result) != 1 || resp.Result[0].Type != "video" {
+		t.Fatalf("Invalid active players: %v", resp)
+	}
+}
+
+func TestKodiPlayerGetItemCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PlayerGetItem(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Item.Type != "channel" || resp.Result.Item.ID != 1 {
+		t.Fatalf("Invalid player item: %v", resp)
+	}
+}
+
+func TestKodiPlayerGetPropertiesCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PlayerGetProperties(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Speed != 1 {
+		t.Fatalf("Invalid player speed: %v", resp)
+	}
+}
+
+func TestKodiPlayerStopCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PlayerStop(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result != "OK" {
+		t.Fatalf("Invalid Player Stop response: %v", resp)
+	}
+}
+
+func TestKodiProfilesGetCurrentProfileCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.ProfilesGetCurrentProfile()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Label != "Kids" {
+		t.Fatalf("Invalid current profile: %v", resp)
+	}
+}
+
+func TestKodiPVRGetChannelDetailsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PVRGetChannelDetails(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	details := resp.Result.ChannelDetails
+	if details.BroadcastNow == nil || details.BroadcastNow.ProgressPercentage != 42.5 || details.BroadcastNext == nil {
+		t.Fatalf("Invalid channel details: %v", resp)
+	}
+}
+
+func TestKodiPVRGetBroadcastsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.PVRGetBroadcasts(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if len(resp.Result.Broadcasts) != 2 || resp.Result.Broadcasts[1].StartTime != "2016-07-10 18:30:00" {
+		t.Fatalf("Invalid broadcasts: %v", resp)
+	}
+}
+
+func TestKodiFilesGetSourcesCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.FilesGetSources("video")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if len(resp.Result.Sources) != 2 || resp.Result.Sources[0].File != "smb://nas/movies/" {
+		t.Fatalf("Invalid sources: %v", resp)
+	}
+}
+
+func TestKodiFilesGetDirectoryCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	resp, err := client.WithTimeout(time.Second).FilesGetDirectory("smb://nas/movies/", "video")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log.Infof("Resp: %v", resp)
+	if resp.Result.Limits.Total != 1 || resp.Result.Files[0].Label != "Aladdin.mkv" {
+		t.Fatalf("Invalid directory: %v", resp)
+	}
+}
+
+func TestKodiLibraryActionsCall(t *testing.T) {
+	req := &Request{}
+	h, client := getClientAndServer(t, req)
+	defer h.Close()
+
+	for method, action := range map[string]func() (*ActionResponse, error){
+		"VideoLibrary.Scan":  client.VideoScan,
+		"VideoLibrary.Clean": client.VideoClean,
+		"AudioLibrary.Scan":  client.AudioScan,
+		"AudioLibrary.Clean": client.AudioClean,
+	} {
+		resp, err := action()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if resp.Result != "OK" || req.Method != method {
+			t.Fatalf("Invalid %s response: %v", method, resp)
+		}
+	}
+}
@@ -23,12 +23,25 @@ type ListLimitsReturned struct {
 
 // type Result string
 
+// CallResponse define a generic response after a RPC call
+type CallResponse struct {
+	ResponseBase
+	Result interface{} `json:"result,omitempty"`
+}
+
 // PingResponse define a response after a Ping RPC call
 type PingResponse struct {
 	ResponseBase
 	Result string `json:"result,omitempty"`
 }
 
+// ActionResponse define a response after a RPC call which performs an
+// action, like a library scan
+type ActionResponse struct {
+	ResponseBase
+	Result string `json:"result,omitempty"`
+}
+
 // GUI
 
 // ShowNotificationResponse define a response after a ShowNotification RPC call
@@ -37,6 +50,78 @@ type ShowNotificationResponse struct {
 	Result string `json:"result,omitempty"`
 }
 
+// XBMC
+
+// GetInfoLabelsResponse define a response after a GetInfoLabels RPC call
+type GetInfoLabelsResponse struct {
+	ResponseBase
+	Result map[string]string `json:"result,omitempty"`
+}
+
+// GetInfoBooleansResponse define a response after a GetInfoBooleans RPC call
+type GetInfoBooleansResponse struct {
+	ResponseBase
+	Result map[string]bool `json:"result,omitempty"`
+}
+
+// Player
+
+// Player define the Kodi active player entity
+type Player struct {
+	PlayerID int    `json:"playerid"`
+	Type     string `json:"type"`
+}
+
+// PlayerGetActivePlayersResponse define the response to the Player GetActivePlayers RPC call
+type PlayerGetActivePlayersResponse struct {
+	ResponseBase
+	Result []Player `json:"result,omitempty"`
+}
+
+// PlayerItem define the item played by a Kodi player
+type PlayerItem struct {
+	ID          int    `json:"id,omitempty"`
+	Type        string `json:"type"`
+	Label       string `json:"label,omitempty"`
+	Title       string `json:"title,omitempty"`
+	ShowTitle   string `json:"showtitle,omitempty"`
+	Channel     string `json:"channel,omitempty"`
+	ChannelType string `json:"channeltype,omitempty"`
+}
+
+// PlayerItemResponse define the Kodi player item response
+type PlayerItemResponse struct {
+	Item PlayerItem `json:"item"`
+}
+
+// PlayerGetItemResponse define the response to the Player GetItem RPC call
+type PlayerGetItemResponse struct {
+	ResponseBase
+	Result PlayerItemResponse `json:"result,omitempty"`
+}
+
+// Profile define a Kodi profile
+type Profile struct {
+	Label string `json:"label"`
+}
+
+// ProfilesGetCurrentProfileResponse define the response to the Profiles GetCurrentProfile RPC call
+type ProfilesGetCurrentProfileResponse struct {
+	ResponseBase
+	Result Profile `json:"result,omitempty"`
+}
+
+// PlayerProperties define the state of a Kodi player
+type PlayerProperties struct {
+	Speed int `json:"speed"`
+}
+
+// PlayerGetPropertiesResponse define the response to the Player GetProperties RPC call
+type PlayerGetPropertiesResponse struct {
+	ResponseBase
+	Result PlayerProperties `json:"result,omitempty"`
+}
+
 // Audio Library
 
 // Artist define the Kodi artist entity
@@ -76,6 +161,7 @@ type AudioGetAlbumsResponse struct {
 type Song struct {
 	SongID int    `json:"songid"`
 	Label  string `json:"label,omitempty"`
+	File   string `json:"file,omitempty"`
 }
 
 type SongsResponse struct {
@@ -108,6 +194,7 @@ type VideoGetTVShowsResponse struct {
 type Movie struct {
 	MovieID int    `json:"movieid"`
 	Label   string `json:"label,omitempty"`
+	File    string `json:"file,omitempty"`
 }
 
 type MoviesResponse struct {
@@ -120,6 +207,25 @@ type VideoGetMoviesResponse struct {
 	Result MoviesResponse `json:"result,omitempty"`
 }
 
+// Episode define the Kodi TV show episode entity
+type Episode struct {
+	EpisodeID int    `json:"episodeid"`
+	Label     string `json:"label,omitempty"`
+	File      string `json:"file,omitempty"`
+}
+
+// EpisodesResponse define the Kodi episodes list response
+type EpisodesResponse struct {
+	Episodes []Episode           `json:"episodes,omitempty"`
+	Limits   *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// VideoGetEpisodesResponse define the response to the GetEpisodes RPC call
+type VideoGetEpisodesResponse struct {
+	ResponseBase
+	Result EpisodesResponse `json:"result,omitempty"`
+}
+
 type Genre struct {
 	GenreID int    `json:"genreid"`
 	Label   string `json:"label,omitempty"`
@@ -134,3 +240,215 @@ type VideoGetGenresResponse struct {
 	ResponseBase
 	Result GenresResponse `json:"result,omitempty"`
 }
+
+// Addons
+
+// Addon define the Kodi add-on entity
+type Addon struct {
+	AddonID   string `json:"addonid"`
+	Type      string `json:"type"`
+	Name      string `json:"name,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Enabled   bool   `json:"enabled"`
+	Installed bool   `json:"installed"`
+	// Broken is false, or the reason why the add-on is broken
+	Broken interface{} `json:"broken,omitempty"`
+}
+
+// IsBroken returns true if the add-on is marked as broken
+func (a *Addon) IsBroken() bool {
+	switch broken := a.Broken.(type) {
+	case bool:
+		return broken
+	case string:
+		return len(broken) > 0
+	}
+	return false
+}
+
+// AddonsResponse define the Kodi add-ons list response
+type AddonsResponse struct {
+	Addons []Addon             `json:"addons,omitempty"`
+	Limits *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// AddonsGetAddonsResponse define the response to the GetAddons RPC call
+type AddonsGetAddonsResponse struct {
+	ResponseBase
+	Result AddonsResponse `json:"result,omitempty"`
+}
+
+// PVR
+
+// PVRProperties define the state of the Kodi PVR
+type PVRProperties struct {
+	Available bool `json:"available"`
+	Recording bool `json:"recording"`
+	Scanning  bool `json:"scanning"`
+}
+
+// PVRGetPropertiesResponse define the response to the PVR GetProperties RPC call
+type PVRGetPropertiesResponse struct {
+	ResponseBase
+	Result PVRProperties `json:"result,omitempty"`
+}
+
+// ChannelGroup define the Kodi PVR channel group entity
+type ChannelGroup struct {
+	ChannelGroupID int    `json:"channelgroupid"`
+	ChannelType    string `json:"channeltype,omitempty"`
+	Label          string `json:"label,omitempty"`
+}
+
+// ChannelGroupsResponse define the Kodi PVR channel groups list response
+type ChannelGroupsResponse struct {
+	ChannelGroups []ChannelGroup      `json:"channelgroups,omitempty"`
+	Limits        *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// PVRGetChannelGroupsResponse define the response to the PVR GetChannelGroups RPC call
+type PVRGetChannelGroupsResponse struct {
+	ResponseBase
+	Result ChannelGroupsResponse `json:"result,omitempty"`
+}
+
+// Channel define the Kodi PVR channel entity
+type Channel struct {
+	ChannelID int    `json:"channelid"`
+	Label     string `json:"label,omitempty"`
+}
+
+// ChannelsResponse define the Kodi PVR channels list response
+type ChannelsResponse struct {
+	Channels []Channel           `json:"channels,omitempty"`
+	Limits   *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// PVRGetChannelsResponse define the response to the PVR GetChannels RPC call
+type PVRGetChannelsResponse struct {
+	ResponseBase
+	Result ChannelsResponse `json:"result,omitempty"`
+}
+
+// Recording define the Kodi PVR recording entity
+type Recording struct {
+	RecordingID int    `json:"recordingid"`
+	Label       string `json:"label,omitempty"`
+}
+
+// RecordingsResponse define the Kodi PVR recordings list response
+type RecordingsResponse struct {
+	Recordings []Recording         `json:"recordings,omitempty"`
+	Limits     *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// PVRGetRecordingsResponse define the response to the PVR GetRecordings RPC call
+type PVRGetRecordingsResponse struct {
+	ResponseBase
+	Result RecordingsResponse `json:"result,omitempty"`
+}
+
+// Timer define the Kodi PVR timer entity
+type Timer struct {
+	TimerID int    `json:"timerid"`
+	Label   string `json:"label,omitempty"`
+	State   string `json:"state,omitempty"`
+}
+
+// TimersResponse define the Kodi PVR timers list response
+type TimersResponse struct {
+	Timers []Timer             `json:"timers,omitempty"`
+	Limits *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// PVRGetTimersResponse define the response to the PVR GetTimers RPC call
+type PVRGetTimersResponse struct {
+	ResponseBase
+	Result TimersResponse `json:"result,omitempty"`
+}
+
+// BroadcastTimeLayout is the layout of the broadcast times, in UTC
+const BroadcastTimeLayout = "2006-01-02 15:04:05"
+
+// Broadcast define the Kodi PVR broadcast entity
+type Broadcast struct {
+	BroadcastID        int      `json:"broadcastid"`
+	Label              string   `json:"label,omitempty"`
+	Title              string   `json:"title,omitempty"`
+	StartTime          string   `json:"starttime,omitempty"`
+	EndTime            string   `json:"endtime,omitempty"`
+	Genre              []string `json:"genre,omitempty"`
+	ProgressPercentage float64  `json:"progresspercentage,omitempty"`
+}
+
+// ChannelDetails define the details of a Kodi PVR channel
+type ChannelDetails struct {
+	ChannelID     int        `json:"channelid"`
+	Label         string     `json:"label,omitempty"`
+	ChannelType   string     `json:"channeltype,omitempty"`
+	BroadcastNow  *Broadcast `json:"broadcastnow,omitempty"`
+	BroadcastNext *Broadcast `json:"broadcastnext,omitempty"`
+}
+
+// ChannelDetailsResponse define the Kodi PVR channel details response
+type ChannelDetailsResponse struct {
+	ChannelDetails ChannelDetails `json:"channeldetails"`
+}
+
+// PVRGetChannelDetailsResponse define the response to the PVR GetChannelDetails RPC call
+type PVRGetChannelDetailsResponse struct {
+	ResponseBase
+	Result ChannelDetailsResponse `json:"result,omitempty"`
+}
+
+// BroadcastsResponse define the Kodi PVR broadcasts list response
+type BroadcastsResponse struct {
+	Broadcasts []Broadcast         `json:"broadcasts,omitempty"`
+	Limits     *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// PVRGetBroadcastsResponse define the response to the PVR GetBroadcasts RPC call
+type PVRGetBroadcastsResponse struct {
+	ResponseBase
+	Result BroadcastsResponse `json:"result,omitempty"`
+}
+
+// Files
+
+// Source define the Kodi media source entity
+type Source struct {
+	File  string `json:"file"`
+	Label string `json:"label,omitempty"`
+}
+
+// SourcesResponse define the Kodi sources list response
+type SourcesResponse struct {
+	Sources []Source            `json:"sources,omitempty"`
+	Limits  *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// FilesGetSourcesResponse define the response to the Files GetSources RPC call
+type FilesGetSourcesResponse struct {
+	ResponseBase
+	Result SourcesResponse `json:"result,omitempty"`
+}
+
+// File define the Kodi file entity
+type File struct {
+	File     string `json:"file"`
+	FileType string `json:"filetype,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+// FilesResponse define the Kodi files list response
+type FilesResponse struct {
+	Files  []File              `json:"files,omitempty"`
+	Limits *ListLimitsReturned `json:"limits,omitempty"`
+}
+
+// FilesGetDirectoryResponse define the response to the Files GetDirectory RPC call
+type FilesGetDirectoryResponse struct {
+	ResponseBase
+	Result FilesResponse `json:"result,omitempty"`
+}
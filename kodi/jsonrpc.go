@@ -36,6 +36,10 @@ type ErrorData struct {
 	Stack  *ErrorStack `json:"stack"`
 }
 
+// FailedToExecuteCode is the error code of the methods Kodi fails to
+// execute, like the PVR methods while the PVR is not enabled
+const FailedToExecuteCode = -32100
+
 // ResponseError define the error member of the response when a rpc call encounters an error
 type ResponseError struct {
 	Code    int        `json:"code"`
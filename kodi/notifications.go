@@ -0,0 +1,188 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kodi
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// Notification define a notification sent by Kodi over the TCP API
+type Notification struct {
+	Jsonrpc string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	Params  NotificationParams `json:"params"`
+}
+
+// NotificationParams define the parameters of a notification
+type NotificationParams struct {
+	Sender string          `json:"sender,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// NotificationHandler is called for each notification received
+type NotificationHandler func(notification *Notification)
+
+// NotificationsListener receives the notifications sent by Kodi using its
+// TCP API (port 9090 by default). The connection is retried until the
+// listener is stopped.
+type NotificationsListener struct {
+	Address    string
+	RetryDelay time.Duration
+
+	mu              sync.Mutex
+	handlers        map[string][]NotificationHandler
+	connectHandlers []func()
+	conn            net.Conn
+	connected       bool
+	stop            chan struct{}
+}
+
+// NewNotificationsListener defines a new listener for the notifications of
+// a Kodi server
+func NewNotificationsListener(address string) *NotificationsListener {
+	return &NotificationsListener{
+		Address:    address,
+		RetryDelay: 10 * time.Second,
+		handlers:   map[string][]NotificationHandler{},
+		stop:       make(chan struct{}),
+	}
+}
+
+// Subscribe registers a handler for a notification method, like
+// "VideoLibrary.OnScanFinished". An empty method subscribes to all the
+// notifications.
+func (l *NotificationsListener) Subscribe(method string, handler NotificationHandler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers[method] = append(l.handlers[method], handler)
+}
+
+// OnConnect registers a handler called each time the listener connects to
+// Kodi, before the notifications are dispatched. The notifications sent
+// while the listener was disconnected are lost.
+func (l *NotificationsListener) OnConnect(handler func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.connectHandlers = append(l.connectHandlers, handler)
+}
+
+// Connected returns true if the listener is connected to Kodi
+func (l *NotificationsListener) Connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.connected
+}
+
+// Start connects to Kodi and dispatches the notifications in background
+func (l *NotificationsListener) Start() {
+	go l.run()
+}
+
+// Stop closes the connection to Kodi
+func (l *NotificationsListener) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.stop:
+		return
+	default:
+	}
+	close(l.stop)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+}
+
+func (l *NotificationsListener) stopped() bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *NotificationsListener) run() {
+	for !l.stopped() {
+		if err := l.listen(); err != nil && !l.stopped() {
+			log.Warnf("Kodi notifications from %s unavailable: %s", l.Address, err)
+		}
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(l.RetryDelay):
+		}
+	}
+}
+
+func (l *NotificationsListener) listen() error {
+	conn, err := net.DialTimeout("tcp", l.Address, l.RetryDelay)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	if l.stopped() {
+		l.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	l.conn = conn
+	handlers := append([]func(){}, l.connectHandlers...)
+	l.mu.Unlock()
+	for _, handler := range handlers {
+		handler()
+	}
+	l.mu.Lock()
+	l.connected = true
+	l.mu.Unlock()
+	log.Infof("Listening Kodi notifications from %s", l.Address)
+
+	defer func() {
+		l.mu.Lock()
+		l.conn = nil
+		l.connected = false
+		l.mu.Unlock()
+		conn.Close()
+	}()
+
+	dec := json.NewDecoder(conn)
+	for {
+		notification := &Notification{}
+		if err := dec.Decode(notification); err != nil {
+			return err
+		}
+		if len(notification.Method) == 0 {
+			// Not a notification
+			continue
+		}
+		log.Debugf("Kodi notification: %s %s", notification.Method, string(notification.Params.Data))
+		l.dispatch(notification)
+	}
+}
+
+func (l *NotificationsListener) dispatch(notification *Notification) {
+	l.mu.Lock()
+	handlers := append([]NotificationHandler{}, l.handlers[notification.Method]...)
+	handlers = append(handlers, l.handlers[""]...)
+	l.mu.Unlock()
+	for _, handler := range handlers {
+		handler(notification)
+	}
+}
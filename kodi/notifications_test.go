@@ -0,0 +1,70 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kodi
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKodiNotifications(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer server.Close()
+	go func() {
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(`{"jsonrpc":"2.0","method":"VideoLibrary.OnScanStarted","params":{"data":null,"sender":"xbmc"}}`))
+		conn.Write([]byte(`{"jsonrpc":"2.0","method":"VideoLibrary.OnScanFinished","params":{"data":null,"sender":"xbmc"}}{"jsonrpc":"2.0",`))
+		conn.Write([]byte(`"method":"AudioLibrary.OnScanFinished","params":{"data":null,"sender":"xbmc"}}`))
+		time.Sleep(time.Second)
+	}()
+
+	listener := NewNotificationsListener(server.Addr().String())
+	received := make(chan string, 10)
+	listener.Subscribe("VideoLibrary.OnScanFinished", func(n *Notification) {
+		received <- n.Method
+	})
+	listener.Subscribe("", func(n *Notification) {
+		received <- "all"
+	})
+	listener.OnConnect(func() {
+		received <- "connected"
+	})
+	listener.Start()
+	defer listener.Stop()
+
+	var methods []string
+	for len(methods) < 5 {
+		select {
+		case method := <-received:
+			methods = append(methods, method)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Missing notifications: %v", methods)
+		}
+	}
+	if methods[0] != "connected" || methods[1] != "all" || methods[2] != "VideoLibrary.OnScanFinished" || methods[3] != "all" || methods[4] != "all" {
+		t.Fatalf("Invalid notifications: %v", methods)
+	}
+	if !listener.Connected() {
+		t.Fatalf("Listener should be connected")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kodi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfoLabels values are formatted for humans by Kodi. These helpers convert
+// them back into numbers.
+
+// BusyInfoLabel is returned by Kodi while an InfoLabel value is being computed
+const BusyInfoLabel = "Busy"
+
+var (
+	numberRegexp      = regexp.MustCompile(`[-+]?[0-9]+(?:[.,][0-9]+)*`)
+	percentRegexp     = regexp.MustCompile(`([-+]?[0-9]+(?:[.,][0-9]+)?)\s*%`)
+	temperatureRegexp = regexp.MustCompile(`^([-+]?[0-9]+(?:[.,][0-9]+)?)\s*°?\s*([CFK])$`)
+	durationRegexp    = regexp.MustCompile(`([0-9]+)\s*([[:alpha:]]+)`)
+	clockRegexp       = regexp.MustCompile(`^(?:([0-9]+):)?([0-9]{1,2}):([0-9]{2})$`)
+	bytesRegexp       = regexp.MustCompile(`([0-9][0-9.,\s\x{00a0}\x{202f}]*)\s*([[:alpha:]]+)`)
+)
+
+// Kodi uses binary multiples for sizes, whatever the unit symbol is
+var byteUnits = map[string]float64{
+	"b":   1,
+	"o":   1,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"ko":  1 << 10,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"mo":  1 << 20,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"go":  1 << 30,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+	"to":  1 << 40,
+	"pb":  1 << 50,
+	"pib": 1 << 50,
+	"po":  1 << 50,
+}
+
+func checkInfoLabel(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return "", fmt.Errorf("Empty InfoLabel value")
+	}
+	if value == BusyInfoLabel {
+		return "", fmt.Errorf("InfoLabel value not yet available")
+	}
+	return value, nil
+}
+
+func parseFloat(value string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+}
+
+// parseLocalizedFloat parse a number using either the dot or the comma as
+// decimal separator, with optional grouping separators ("1,234.5",
+// "1.234,5", "1 234,5", "1.234.567"). A single separator is always the
+// decimal separator ("1,234" is 1.234).
+func parseLocalizedFloat(value string) (float64, error) {
+	value = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'':
+			return -1
+		}
+		return r
+	}, value)
+	lastDot := strings.LastIndex(value, ".")
+	lastComma := strings.LastIndex(value, ",")
+	decimal := ""
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Both separators: the last one is the decimal separator
+		if lastDot > lastComma {
+			decimal = "."
+		} else {
+			decimal = ","
+		}
+	case lastDot >= 0 || lastComma >= 0:
+		separator := "."
+		if lastComma >= 0 {
+			separator = ","
+		}
+		// A repeated separator is a grouping separator
+		if strings.Count(value, separator) == 1 {
+			decimal = separator
+		}
+	}
+	var buf bytes.Buffer
+	for i, r := range value {
+		switch {
+		case len(decimal) > 0 && string(r) == decimal && i == strings.LastIndex(value, decimal):
+			buf.WriteRune('.')
+		case r == '.' || r == ',':
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return strconv.ParseFloat(buf.String(), 64)
+}
+
+// ParseNumber extract the first number from an InfoLabel value, like "59.94",
+// "59.94 fps" or "1,234.5"
+func ParseNumber(value string) (float64, error) {
+	value, err := checkInfoLabel(value)
+	if err != nil {
+		return 0, err
+	}
+	match := numberRegexp.FindString(value)
+	if len(match) == 0 {
+		return 0, fmt.Errorf("Invalid number: %s", value)
+	}
+	return parseLocalizedFloat(match)
+}
+
+// ParsePercent extract a percentage from an InfoLabel value, like "23%".
+// If several percentages are available (ie: "CPU0: 12% CPU1: 4%"), the
+// average value is returned.
+func ParsePercent(value string) (float64, error) {
+	value, err := checkInfoLabel(value)
+	if err != nil {
+		return 0, err
+	}
+	matches := percentRegexp.FindAllStringSubmatch(value, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("Invalid percentage: %s", value)
+	}
+	var total float64
+	for _, match := range matches {
+		percent, err := parseFloat(match[1])
+		if err != nil {
+			return 0, fmt.Errorf("Invalid percentage: %s", value)
+		}
+		total += percent
+	}
+	return total / float64(len(matches)), nil
+}
+
+// ParseTemperature convert an InfoLabel temperature, like "52°C" or "125°F",
+// into degrees Celsius
+func ParseTemperature(value string) (float64, error) {
+	value, err := checkInfoLabel(value)
+	if err != nil {
+		return 0, err
+	}
+	match := temperatureRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("Invalid temperature: %s", value)
+	}
+	temperature, err := parseFloat(match[1])
+	if err != nil {
+		return 0, fmt.Errorf("Invalid temperature: %s", value)
+	}
+	switch match[2] {
+	case "F":
+		return (temperature - 32) * 5 / 9, nil
+	case "K":
+		return temperature - 273.15, nil
+	}
+	return temperature, nil
+}
+
+func durationUnit(unit string) (time.Duration, bool) {
+	unit = strings.ToLower(unit)
+	switch {
+	case strings.HasPrefix(unit, "week"):
+		return 7 * 24 * time.Hour, true
+	case strings.HasPrefix(unit, "day"):
+		return 24 * time.Hour, true
+	case strings.HasPrefix(unit, "hour"), unit == "h":
+		return time.Hour, true
+	case strings.HasPrefix(unit, "min"), unit == "m":
+		return time.Minute, true
+	case strings.HasPrefix(unit, "sec"), unit == "s":
+		return time.Second, true
+	}
+	return 0, false
+}
+
+// ParseDuration convert an InfoLabel duration into a time.Duration. Both the
+// uptime format ("3 days, 4 hours, 12 minutes") and the clock format used by
+// the players ("01:23:45") are supported.
+func ParseDuration(value string) (time.Duration, error) {
+	value, err := checkInfoLabel(value)
+	if err != nil {
+		return 0, err
+	}
+	if match := clockRegexp.FindStringSubmatch(value); match != nil {
+		var duration time.Duration
+		for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+			if len(match[i+1]) == 0 {
+				continue
+			}
+			n, _ := strconv.Atoi(match[i+1])
+			duration += time.Duration(n) * unit
+		}
+		return duration, nil
+	}
+	matches := durationRegexp.FindAllStringSubmatch(value, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("Invalid duration: %s", value)
+	}
+	var duration time.Duration
+	for _, match := range matches {
+		unit, ok := durationUnit(match[2])
+		if !ok {
+			return 0, fmt.Errorf("Invalid duration unit %s: %s", match[2], value)
+		}
+		n, _ := strconv.Atoi(match[1])
+		duration += time.Duration(n) * unit
+	}
+	return duration, nil
+}
+
+// ParseBytes convert an InfoLabel size, like "28.70 GB" or "Free: 1.234,5 MB",
+// into bytes
+func ParseBytes(value string) (float64, error) {
+	value, err := checkInfoLabel(value)
+	if err != nil {
+		return 0, err
+	}
+	for _, match := range bytesRegexp.FindAllStringSubmatch(value, -1) {
+		multiplier, ok := byteUnits[strings.ToLower(match[2])]
+		if !ok {
+			continue
+		}
+		size, err := parseLocalizedFloat(match[1])
+		if err != nil {
+			return 0, fmt.Errorf("Invalid size: %s", value)
+		}
+		return size * multiplier, nil
+	}
+	return 0, fmt.Errorf("Invalid size: %s", value)
+}
+
+// ParseBool convert an InfoLabel boolean, like "True" or "no", into 1 or 0
+func ParseBool(value string) (float64, error) {
+	value, err := checkInfoLabel(value)
+	if err != nil {
+		return 0, err
+	}
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return 1, nil
+	case "false", "no", "off", "0":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("Invalid boolean: %s", value)
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2016 Nicolas Lamirault <nicolas.lamirault@gmail.com>
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kodi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNumber(t *testing.T) {
+	for value, expected := range map[string]float64{
+		"59.94":     59.94,
+		"60.00 fps": 60,
+		"23,98":     23.98,
+		"-4":        -4,
+		"1,234.5":   1234.5,
+		"1.234,5":   1234.5,
+		"1.234.567": 1234567,
+	} {
+		n, err := ParseNumber(value)
+		if err != nil {
+			t.Fatalf("Can't parse number %s: %v", value, err)
+		}
+		if n != expected {
+			t.Fatalf("Invalid number for %s: %f", value, n)
+		}
+	}
+	for _, value := range []string{"", "Busy", "N/A"} {
+		if _, err := ParseNumber(value); err == nil {
+			t.Fatalf("Invalid number accepted: %s", value)
+		}
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	for value, expected := range map[string]float64{
+		"23%":                23,
+		"12.5 %":             12.5,
+		"CPU0: 12% CPU1: 4%": 8,
+		"CPU0:  10% CPU1:  20% CPU2:  30% CPU3:  40%": 25,
+	} {
+		n, err := ParsePercent(value)
+		if err != nil {
+			t.Fatalf("Can't parse percentage %s: %v", value, err)
+		}
+		if n != expected {
+			t.Fatalf("Invalid percentage for %s: %f", value, n)
+		}
+	}
+	if _, err := ParsePercent("42"); err == nil {
+		t.Fatalf("Invalid percentage accepted")
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	for value, expected := range map[string]float64{
+		"52°C":    52,
+		"52 °C":   52,
+		"125.6°F": 52,
+		"212°F":   100,
+		"300K":    26.850000000000023,
+	} {
+		n, err := ParseTemperature(value)
+		if err != nil {
+			t.Fatalf("Can't parse temperature %s: %v", value, err)
+		}
+		if n != expected {
+			t.Fatalf("Invalid temperature for %s: %f", value, n)
+		}
+	}
+	for _, value := range []string{"?", "Busy", "52°Ré"} {
+		if _, err := ParseTemperature(value); err == nil {
+			t.Fatalf("Invalid temperature accepted: %s", value)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"3 days, 4 hours, 12 minutes": 76*time.Hour + 12*time.Minute,
+		"1 day, 1 hour, 1 minute":     25*time.Hour + time.Minute,
+		"5 minutes":                   5 * time.Minute,
+		"2 weeks":                     14 * 24 * time.Hour,
+		"01:23:45":                    time.Hour + 23*time.Minute + 45*time.Second,
+		"23:45":                       23*time.Minute + 45*time.Second,
+	} {
+		d, err := ParseDuration(value)
+		if err != nil {
+			t.Fatalf("Can't parse duration %s: %v", value, err)
+		}
+		if d != expected {
+			t.Fatalf("Invalid duration for %s: %s", value, d)
+		}
+	}
+	for _, value := range []string{"", "Busy", "3 jours"} {
+		if _, err := ParseDuration(value); err == nil {
+			t.Fatalf("Invalid duration accepted: %s", value)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	for value, expected := range map[string]float64{
+		"28.7 GB":           28.7 * (1 << 30),
+		"28,70 GB Total":    28.7 * (1 << 30),
+		"Free: 1.234,5 MB":  1234.5 * (1 << 20),
+		"1,234.5 MB free":   1234.5 * (1 << 20),
+		"1 234,5 Mo libres": 1234.5 * (1 << 20),
+		"2,048 KB":          2.048 * (1 << 10),
+		"1.234 GB":          1.234 * (1 << 30),
+		"1,234 GB":          1.234 * (1 << 30),
+		"1.234.567 KB":      1234567 * (1 << 10),
+		"512 B":             512,
+		"1.5 TiB":           1.5 * (1 << 40),
+	} {
+		n, err := ParseBytes(value)
+		if err != nil {
+			t.Fatalf("Can't parse size %s: %v", value, err)
+		}
+		if n != expected {
+			t.Fatalf("Invalid size for %s: %f", value, n)
+		}
+	}
+	for _, value := range []string{"", "Busy", "Unavailable", "42"} {
+		if _, err := ParseBytes(value); err == nil {
+			t.Fatalf("Invalid size accepted: %s", value)
+		}
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	for value, expected := range map[string]float64{
+		"True":  1,
+		"yes":   1,
+		"1":     1,
+		"False": 0,
+		"off":   0,
+	} {
+		n, err := ParseBool(value)
+		if err != nil {
+			t.Fatalf("Can't parse boolean %s: %v", value, err)
+		}
+		if n != expected {
+			t.Fatalf("Invalid boolean for %s: %f", value, n)
+		}
+	}
+	for _, value := range []string{"", "Busy", "maybe"} {
+		if _, err := ParseBool(value); err == nil {
+			t.Fatalf("Invalid boolean accepted: %s", value)
+		}
+	}
+}
@@ -20,238 +20,70 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 	prom_version "github.com/prometheus/common/version"
 
+	"github.com/nlamirault/kodi_exporter/exporter"
 	"github.com/nlamirault/kodi_exporter/kodi"
 	"github.com/nlamirault/kodi_exporter/version"
 )
 
-const (
-	namespace = "kodi"
-)
-
 var (
-	up = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "up"),
-		"Was the last query of Kodi successful.",
-		nil, nil,
-	)
-	artistCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "audio_artists"),
-		"How many artists are in the audio library.",
-		nil, nil,
-	)
-	albumCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "audio_albums"),
-		"How many albums are in the audio library.",
-		nil, nil,
-	)
-	songCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "audio_songs"),
-		"How many songs are in the audio library.",
-		nil, nil,
-	)
-	movieCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "video_movies"),
-		"How many movies are in the video library.",
-		nil, nil,
-	)
-	tvshowCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "video_tvshows"),
-		"How many TV shows are in the video library.",
-		nil, nil,
-	)
-	// movieGenres = prometheus.NewDesc(
-	// 	prometheus.BuildFQName(namespace, "", "video_movies_genres"),
-	// 	"Genres for movies in the video library.",
-	// 	nil, nil,
-	// )
-	// tvshowGenres = prometheus.NewDesc(
-	// 	prometheus.BuildFQName(namespace, "", "video_tvshows_genres"),
-	// 	"Genres for TV shows in the video library.",
-	// 	nil, nil,
-	// )
-	// movieGenres = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-	// 	Namespace: namespace,
-	// 	Name:      "video_movies_genres",
-	// 	Help:      "Genres for movies in the video library.",
-	// }, []string{"label"})
-	// tvshowGenres = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-	// 	Namespace: namespace,
-	// 	Name:      "video_tvshows_genres",
-	// 	Help:      "Genres for TV shows in the video library.",
-	// }, []string{"label"})
+	// collectorStates are the -collector.<name> flags
+	collectorStates = map[string]*bool{}
+	// collectorDisabled are the -no-collector.<name> flags
+	collectorDisabled = map[string]*bool{}
 )
 
-// Exporter collects Kodi stats from the given server and exports them using
-// the prometheus metrics package.
-type Exporter struct {
-	URI    string
-	Client *kodi.Client
-}
-
-// NewExporter returns an initialized Exporter.
-func NewExporter(uri string, username string, password string) (*Exporter, error) {
-	log.Infoln("Setup Kodi client: %s %s", uri, username)
-	client, err := kodi.NewClient(uri, username, password)
-	if err != nil {
-		return nil, fmt.Errorf("Can't create the Kodi client: %s", err)
-	}
-	resp, err := client.ShowNotification(
-		`Prometheus`, `Prometheus exporter for Kodi is ready`)
-
-	if err != nil {
-		return nil, err
-	}
-	if resp.Error != nil {
-		return nil, fmt.Errorf("%s [%d]", resp.Error.Message, resp.Error.Code)
-	}
-	log.Infof("Kodi API connection: %s", resp.Result)
-
-	log.Debugln("Init exporter")
-	return &Exporter{
-		URI:    uri,
-		Client: client,
-	}, nil
-}
-
-// Describe describes all the metrics ever exported by the Kodi exporter.
-// It implements prometheus.Collector.
-func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- up
-	ch <- artistCount
-	ch <- albumCount
-	ch <- songCount
-	ch <- movieCount
-	ch <- tvshowCount
-	// ch <- movieGenres
-	// ch <- tvshowGenres
-}
-
-// Collect fetches the stats from configured Kodi location and delivers them
-// as Prometheus metrics.
-// It implements prometheus.Collector.
-func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	log.Infof("Kodi exporter starting")
-	if e.Client == nil {
-		log.Errorf("Kodi client not configured.")
-		return
-	}
-
-	resp, err := e.Client.Ping()
-	if err != nil || resp.Error != nil {
-		ch <- prometheus.MustNewConstMetric(
-			up, prometheus.GaugeValue, 0,
-		)
-		log.Errorf("%s [%d]", resp.Error.Message, resp.Error.Code)
-		return
+func init() {
+	prometheus.MustRegister(prom_version.NewCollector("kodi_exporter"))
+	for _, collector := range exporter.RegisteredCollectors() {
+		collectorStates[collector.Name] = flag.Bool("collector."+collector.Name, collector.DefaultEnabled, collector.Help)
+		collectorDisabled[collector.Name] = flag.Bool("no-collector."+collector.Name, false, fmt.Sprintf("Disable the %s collector.", collector.Name))
 	}
-	log.Infof("Ping: %s", resp.Result)
-	ch <- prometheus.MustNewConstMetric(
-		up, prometheus.GaugeValue, 1,
-	)
-
-	e.collectAudioMetrics(ch)
-	e.collectVideoMetrics(ch)
-	log.Infof("Kodi exporter finished")
 }
 
-func (e *Exporter) collectAudioMetrics(ch chan<- prometheus.Metric) {
-	artistsResp, err := e.Client.AudioGetArtists()
-	if err != nil || artistsResp.Error != nil {
-		// FIXME: How should we handle a partial failure like this?
-	} else {
-		//size := float64(len(artistsResp.Result.Artists))
-		size := float64(artistsResp.Result.Limits.Total)
-		ch <- prometheus.MustNewConstMetric(
-			artistCount, prometheus.GaugeValue, size,
-		)
-		log.Infof("Artists: %d", size)
+// enabledCollectors returns the state of the collectors from the flags
+func enabledCollectors() map[string]bool {
+	enabled := map[string]bool{}
+	for name, state := range collectorStates {
+		enabled[name] = *state && !*collectorDisabled[name]
 	}
-
-	albumsResp, err := e.Client.AudioGetAlbums()
-	if err != nil || albumsResp.Error != nil {
-		// FIXME: How should we handle a partial failure like this?
-	} else {
-		//size := float64(len(albumsResp.Result.Albums))
-		size := float64(albumsResp.Result.Limits.Total)
-		ch <- prometheus.MustNewConstMetric(
-			albumCount, prometheus.GaugeValue, size,
-		)
-		log.Infof("Albums: %d", size)
-	}
-
-	songsResp, err := e.Client.AudioGetSongs()
-	if err != nil || songsResp.Error != nil {
-		// FIXME: How should we handle a partial failure like this?
-	} else {
-		//size := float64(len(songsResp.Result.Songs))
-		size := float64(songsResp.Result.Limits.Total)
-		ch <- prometheus.MustNewConstMetric(
-			songCount, prometheus.GaugeValue, size,
-		)
-		log.Infof("Songs: %d", size)
-	}
-
-}
-
-func (e *Exporter) collectVideoMetrics(ch chan<- prometheus.Metric) {
-	moviesResp, err := e.Client.VideoGetMovies()
-	if err != nil || moviesResp.Error != nil {
-		// FIXME: How should we handle a partial failure like this?
-	} else {
-		//size := float64(len(moviesResp.Result.Movies))
-		size := float64(moviesResp.Result.Limits.Total)
-		ch <- prometheus.MustNewConstMetric(
-			movieCount, prometheus.GaugeValue, size,
-		)
-		log.Infof("Movies: %d", size)
-	}
-
-	tvshowsResp, err := e.Client.VideoGetTVShows()
-	if err != nil || tvshowsResp.Error != nil {
-		// FIXME: How should we handle a partial failure like this?
-	} else {
-		//size := float64(len(tvshowsResp.Result.Movies))
-		size := float64(tvshowsResp.Result.Limits.Total)
-		ch <- prometheus.MustNewConstMetric(
-			tvshowCount, prometheus.GaugeValue, size,
-		)
-		log.Infof("TV Shows: %d", size)
-	}
-
-	moviesGenresResp, err := e.Client.VideoGetMoviesGenres()
-	if err != nil || moviesGenresResp.Error != nil {
-		// FIXME: How should we handle a partial failure like this?
-		log.Errorf("Kodi error : %v %v", err, moviesGenresResp.Error)
-	} else {
-		log.Infof("Movies Genres: %v", moviesGenresResp.Result)
-	}
-	tvshowsGenresResp, err := e.Client.VideoGetTVShowsGenres()
-	if err != nil || tvshowsGenresResp.Error != nil {
-		// FIXME: How should we handle a partial failure like this?
-		log.Errorf("Kodi error : %v %v", err, tvshowsGenresResp.Error)
-	} else {
-		log.Infof("TV Shows Genres: %v", tvshowsGenresResp.Result)
-	}
-}
-
-func init() {
-	prometheus.MustRegister(prom_version.NewCollector("kodi_exporter"))
+	return enabled
 }
 
 func main() {
 	var (
-		showVersion   = flag.Bool("version", false, "Print version information.")
-		listenAddress = flag.String("web.listen-address", ":9111", "Address to listen on for web interface and telemetry.")
-		metricsPath   = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-		kodiServer    = flag.String("kodi.server", "localhost:9090", "HTTP API address of the Kodi server.")
-		kodiPort      = flag.String("kodi.port", "8080", "HTTP port the Kodi JSONRPC API.")
-		kodiUsername  = flag.String("kodi.username", "", "Username for authentication to the Kodi server.")
-		kodiPassword  = flag.String("kodi.password", "", "Password for authentication to the Kodi server.")
+		showVersion    = flag.Bool("version", false, "Print version information.")
+		listenAddress  = flag.String("web.listen-address", ":9111", "Address to listen on for web interface and telemetry.")
+		metricsPath    = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+		readyPolicy    = flag.String("web.ready-policy", exporter.ReadyOnProbe, "When the exporter is ready: once Kodi was reached (probe), or once the configuration is loaded (config).")
+		kodiServer     = flag.String("kodi.server", "localhost:9090", "HTTP API address of the Kodi server.")
+		kodiPort       = flag.String("kodi.port", "8080", "HTTP port the Kodi JSONRPC API.")
+		kodiUsername   = flag.String("kodi.username", "", "Username for authentication to the Kodi server.")
+		kodiPassword   = flag.String("kodi.password", "", "Password for authentication to the Kodi server.")
+		kodiTCPPort    = flag.String("kodi.tcp-port", "9090", "TCP port of the Kodi JSONRPC API, used for notifications.")
+		kodiNotify     = flag.Bool("kodi.notifications", false, "Listen to the Kodi notifications.")
+		kodiRetryDelay = flag.Duration("kodi.retry-delay", 30*time.Second, "Delay between the connection attempts to the Kodi server on startup.")
+		kodiStartup    = flag.Bool("kodi.startup-notification", false, "Show a notification on Kodi once the exporter is connected.")
+		kodiLabels     = flag.String("kodi.labels", "", "Labels added to all the Kodi metrics: name=value,name=value.")
+		seriesLimit    = flag.Int("kodi.series-limit", 0, "Maximum number of series of a metric, the others being folded into an \"other\" series (0 for no limit).")
+		kodiInstance   = flag.Bool("kodi.instance-label", false, "Add the kodi_instance label to all the Kodi metrics, using the name of the Kodi device.")
+		kodiName       = flag.String("kodi.instance", "", "Value of the kodi_instance label added to all the Kodi metrics, instead of the name of the Kodi device.")
+		pollInterval   = flag.Duration("kodi.poll-interval", 0, "Query Kodi in background at this interval, and serve the cached metrics (0 to query Kodi on scrapes).")
+		pollStaleness  = flag.Duration("kodi.poll-staleness", 5*time.Minute, "Drop the cached metrics older than this threshold.")
+		libraryState   = flag.String("library.state-file", "", "File where the library items are saved, to detect the changes across restarts.")
+		libraryLog     = flag.Bool("library.log-changes", false, "Log the titles of the items added to or removed from the library.")
+		libraryResync  = flag.Duration("library.resync-interval", time.Hour, "Refresh interval of the library metrics while the library changes are notified by Kodi.")
+		historyFile    = flag.String("history.file", "", "Database file where the playback sessions are recorded.")
+		historyPoll    = flag.Duration("history.interval", time.Minute, "Polling interval of the players recording the playback sessions.")
+		configFile     = flag.String("config.file", "", "Path to the configuration file.")
+		sourcesTimeout = flag.Duration("collector.sources.timeout", 5*time.Second, "Timeout of a media source probe.")
 	)
 	flag.Parse()
 
@@ -260,24 +92,154 @@ func main() {
 		os.Exit(0)
 	}
 
+	if !exporter.ValidReadyPolicy(*readyPolicy) {
+		log.Errorf("Invalid ready policy : %s", *readyPolicy)
+		os.Exit(1)
+	}
+
+	constLabels, err := exporter.ParseLabels(*kodiLabels)
+	if err != nil {
+		log.Errorf("Invalid labels : %s", err)
+		os.Exit(1)
+	}
+
 	log.Infoln("Starting kodi_exporter", prom_version.Info())
 	log.Infoln("Build context", prom_version.BuildContext())
 
-	exporter, err := NewExporter(fmt.Sprintf("http://%s:%s", *kodiServer, *kodiPort), *kodiUsername, *kodiPassword)
+	config := &exporter.Config{}
+	if len(*configFile) > 0 {
+		config, err = exporter.LoadConfig(*configFile)
+		if err != nil {
+			log.Errorf("Can't load configuration : %s", err)
+			os.Exit(1)
+		}
+	}
+
+	uri := fmt.Sprintf("http://%s:%s", *kodiServer, *kodiPort)
+	log.Infof("Setup Kodi client: %s %s", uri, *kodiUsername)
+	client, err := kodi.NewClient(uri, *kodiUsername, *kodiPassword)
+	if err != nil {
+		log.Errorf("Can't create the Kodi client : %s", err)
+		os.Exit(1)
+	}
+	kodiExporter, err := exporter.New(exporter.Options{
+		Client:         client,
+		Collectors:     enabledCollectors(),
+		ConstLabels:    constLabels,
+		InstanceLabel:  *kodiInstance,
+		Instance:       *kodiName,
+		SeriesLimit:    *seriesLimit,
+		Config:         config,
+		SourcesTimeout: *sourcesTimeout,
+		PollInterval:   *pollInterval,
+		Staleness:      *pollStaleness,
+		ResyncInterval: *libraryResync,
+	})
 	if err != nil {
 		log.Errorf("Can't create exporter : %s", err)
 		os.Exit(1)
 	}
+	kodiExporter.Connect(*kodiRetryDelay, *kodiStartup)
+	if err := kodiExporter.LoadLibraryState(*libraryState, *libraryLog); err != nil {
+		log.Errorf("Can't load library state : %s", err)
+		os.Exit(1)
+	}
+	var history *exporter.PlaybackHistory
+	if len(*historyFile) > 0 {
+		history, err = exporter.NewPlaybackHistory(exporter.HistoryOptions{
+			Client:   client,
+			Filename: *historyFile,
+			Interval: *historyPoll,
+		})
+		if err != nil {
+			log.Errorf("Can't open playback history : %s", err)
+			os.Exit(1)
+		}
+		history.Start()
+	}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		log.Infof("Received %s, shutting down", <-signals)
+		if history != nil {
+			history.Stop()
+			if err := history.Close(); err != nil {
+				log.Errorf("Can't close playback history : %s", err)
+			}
+		}
+		os.Exit(0)
+	}()
+	if *kodiNotify {
+		listener := kodi.NewNotificationsListener(fmt.Sprintf("%s:%s", *kodiServer, *kodiTCPPort))
+		kodiExporter.SubscribeNotifications(listener)
+		if history != nil {
+			history.Subscribe(listener)
+		}
+		listener.Start()
+	}
+	if *pollInterval > 0 {
+		kodiExporter.StartPolling()
+	}
 	log.Infoln("Register exporter")
-	prometheus.MustRegister(exporter)
+	prometheus.MustRegister(kodiExporter)
+	if history != nil {
+		prometheus.MustRegister(kodiExporter.Labelled(history))
+	}
+
+	if len(config.Maintenance) > 0 {
+		maintenance, err := exporter.NewMaintenance(exporter.MaintenanceOptions{
+			Client: client,
+			Jobs:   config.Maintenance,
+		})
+		if err != nil {
+			log.Errorf("Can't create maintenance jobs : %s", err)
+			os.Exit(1)
+		}
+		prometheus.MustRegister(kodiExporter.Labelled(maintenance))
+		maintenance.Start()
+	}
+
+	if config.ScreenTime != nil {
+		screenTime, err := exporter.NewScreenTime(exporter.ScreenTimeOptions{
+			Client: client,
+			Config: *config.ScreenTime,
+		})
+		if err != nil {
+			log.Errorf("Can't create screen time budgets : %s", err)
+			os.Exit(1)
+		}
+		prometheus.MustRegister(kodiExporter.Labelled(screenTime))
+		screenTime.Start()
+	}
+
+	if config.Alerts != nil {
+		alerts, err := exporter.NewAlertsReceiver(exporter.AlertsOptions{
+			Client: client,
+			Config: *config.Alerts,
+		})
+		if err != nil {
+			log.Errorf("Can't create alerts receiver : %s", err)
+			os.Exit(1)
+		}
+		prometheus.MustRegister(kodiExporter.Labelled(alerts))
+		http.Handle(exporter.AlertsPath, alerts)
+	}
 
 	http.Handle(*metricsPath, prometheus.Handler())
+	http.HandleFunc(exporter.HealthyPath, exporter.HealthyHandler)
+	http.HandleFunc(exporter.ReadyPath, kodiExporter.ReadyHandler(*readyPolicy))
+	http.HandleFunc(exporter.TargetsPath, kodiExporter.TargetsHandler)
+	if history != nil {
+		http.Handle(exporter.HistoryPath, history.Handler())
+		http.Handle(exporter.HistoryPath+"/", history.Handler())
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
              <head><title>Kodi Exporter</title></head>
              <body>
              <h1>Kodi Exporter</h1>
              <p><a href='` + *metricsPath + `'>Metrics</a></p>
+             <p><a href='` + exporter.TargetsPath + `'>Targets</a></p>
              </body>
              </html>`))
 	})